@@ -3,8 +3,14 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"gopkg.in/yaml.v2"
 )
 
@@ -17,26 +23,121 @@ const (
 
 type DBType string
 
+type LogSource string
+
+const (
+	LogSourceGetLogs  LogSource = "getLogs"
+	LogSourceReceipts LogSource = "receipts"
+)
+
+type TimestampSource string
+
+const (
+	TimestampSourceRPC      TimestampSource = "rpc"
+	TimestampSourceEstimate TimestampSource = "estimate"
+)
+
 type Contract struct {
-	Name       string
-	Address    string
-	StartBlock int64
+	Name             string
+	Network          string
+	Address          string
+	StartBlock       int64
+	HeadPollInterval time.Duration
+	RangeDelay       time.Duration
+	ABIVersions      []ABIVersion
+	Enabled          bool
+	EventStartBlocks map[string]uint64
+	RPCEndpoint      string
+	ChainID          int64
+}
+
+type ABIVersion struct {
+	Name      string                          `json:"name"`
+	FromBlock uint64                          `json:"fromBlock"`
+	Layouts   map[string]map[string]DataField `json:"layouts"`
+}
+
+type DataField struct {
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+}
+
+func (c Contract) ABIVersionAt(blockNumber uint64) string {
+	version := ""
+	for _, v := range c.ABIVersions {
+		if v.FromBlock <= blockNumber {
+			version = v.Name
+		}
+	}
+	return version
+}
+
+func (c Contract) DataLayoutAt(blockNumber uint64, eventName string) map[string]DataField {
+	var layout map[string]DataField
+	for _, v := range c.ABIVersions {
+		if v.FromBlock <= blockNumber {
+			layout = v.Layouts[eventName]
+		}
+	}
+	return layout
 }
 
+var KnownContractNames = []string{"WhizyPredictionMarket", "ProtocolSelector", "RebalancerDelegation"}
+
 var (
 	WhizyPredictionMarketContract Contract
 	ProtocolSelectorContract      Contract
 	RebalancerDelegationContract  Contract
 	Contracts                     []Contract
+	NetworkContracts              map[string][]Contract
 )
 
+type NetworkEndpoint struct {
+	Name        string `yaml:"name"`
+	RPCEndpoint string `yaml:"rpcEndpoint"`
+	ChainID     int64  `yaml:"chainId"`
+}
+
+func (cfg Config) IndexedNetworks() []NetworkEndpoint {
+	if len(cfg.Networks) > 0 {
+		return cfg.Networks
+	}
+	return []NetworkEndpoint{{Name: cfg.Network, RPCEndpoint: cfg.RPCEndpoint, ChainID: cfg.ChainID}}
+}
+
+func (cfg Config) TokenDecimalsFor(address string) (int, bool) {
+	d, ok := cfg.TokenDecimals[strings.ToLower(address)]
+	return d, ok
+}
+
+func (cfg Config) NetworkNames() []string {
+	var names []string
+	for _, network := range cfg.IndexedNetworks() {
+		names = append(names, network.Name)
+	}
+	return names
+}
+
+type BlockRange struct {
+	FromBlock uint64 `yaml:"fromBlock"`
+	ToBlock   uint64 `yaml:"toBlock"`
+}
+
 type NetworkConfig map[string]map[string]struct {
-	Address    string `json:"address"`
-	StartBlock int64  `json:"startBlock"`
+	Address          string            `json:"address"`
+	StartBlock       int64             `json:"startBlock"`
+	HeadPollInterval string            `json:"headPollInterval"`
+	RangeDelay       string            `json:"rangeDelay"`
+	ABIVersions      []ABIVersion      `json:"abiVersions"`
+	Enabled          *bool             `json:"enabled"`
+	EventStartBlocks map[string]uint64 `json:"eventStartBlocks"`
+	RPCEndpoint      string            `json:"rpcEndpoint"`
 }
 
 const (
 	DBPostgres DBType = "postgres"
+	DBSQLite   DBType = "sqlite"
+	DBMySQL    DBType = "mysql"
 )
 
 type Config struct {
@@ -47,6 +148,9 @@ type Config struct {
 	DBUser                  string `yaml:"dbUser"`
 	DBPass                  string `yaml:"dbPass"`
 	DBName                  string `yaml:"dbName"`
+	DBSSLMode               string `yaml:"dbSslMode"`
+	DBSSLRootCert           string `yaml:"dbSslRootCert"`
+	DBLogLevel              string `yaml:"dbLogLevel"`
 	RPCEndpoint             string `yaml:"rpcEndpoint"`
 	Network                 string `yaml:"network"`
 	NetworksFile            string `yaml:"networksFile"`
@@ -54,6 +158,73 @@ type Config struct {
 	ForceResyncOnEveryStart bool   `yaml:"forceResyncOnEveryStart"`
 	MigrateOnStart          bool   `yaml:"migrateOnStart"`
 	BlockBatchSize          int    `yaml:"blockBatchSize"`
+	Environment             string `yaml:"environment"`
+	VerifyEmptyRanges       bool   `yaml:"verifyEmptyRanges"`
+	DryRun                  bool   `yaml:"dryRun"`
+	PprofAddr               string `yaml:"pprofAddr"`
+	APIAddr                 string `yaml:"apiAddr"`
+	Debug                   bool   `yaml:"debug"`
+	UpsertOnConflict        bool   `yaml:"upsertOnConflict"`
+	SkipSelfTest            bool   `yaml:"skipSelfTest"`
+	DiscoverStartBlocks     bool   `yaml:"discoverStartBlocks"`
+	StoreBlockTime          bool   `yaml:"storeBlockTime"`
+
+	DBLogColor  *bool  `yaml:"dbLogColor"`
+	TablePrefix string `yaml:"tablePrefix"`
+
+	HeadPollInterval time.Duration `yaml:"headPollInterval"`
+	RangeDelay       time.Duration `yaml:"rangeDelay"`
+	RPCTimeout       time.Duration `yaml:"rpcTimeout"`
+	StartupJitter    time.Duration `yaml:"startupJitter"`
+
+	MaxContractRestarts int `yaml:"maxContractRestarts"`
+
+	RPCRateLimit float64           `yaml:"rpcRateLimit"`
+	RPCRateBurst int               `yaml:"rpcRateBurst"`
+	MinLogRange  int               `yaml:"minLogRange"`
+	RPCHeaders   map[string]string `yaml:"rpcHeaders"`
+
+	LogSource LogSource `yaml:"logSource"`
+
+	TimestampSource    TimestampSource `yaml:"timestampSource"`
+	EstimatedBlockTime time.Duration   `yaml:"estimatedBlockTime"`
+
+	TimestampCacheSize int `yaml:"timestampCacheSize"`
+	InsertBatchSize    int `yaml:"insertBatchSize"`
+	MinBatchSize       int `yaml:"minBatchSize"`
+	MaxBatchSize       int `yaml:"maxBatchSize"`
+
+	InsertBufferSize     int           `yaml:"insertBufferSize"`
+	InsertBufferInterval time.Duration `yaml:"insertBufferInterval"`
+
+	SyncStateCommitRanges   int           `yaml:"syncStateCommitRanges"`
+	SyncStateCommitInterval time.Duration `yaml:"syncStateCommitInterval"`
+	TrackScannedRanges      bool          `yaml:"trackScannedRanges"`
+
+	Confirmations uint64 `yaml:"confirmations"`
+	MaxReorgDepth uint64 `yaml:"maxReorgDepth"`
+
+	IncludeEvents []string `yaml:"includeEvents"`
+	ExcludeEvents []string `yaml:"excludeEvents"`
+
+	ParseFailureReportInterval time.Duration `yaml:"parseFailureReportInterval"`
+	UnknownSignatureThreshold  float64       `yaml:"unknownSignatureThreshold"`
+	ThroughputWindow           time.Duration `yaml:"throughputWindow"`
+	ThroughputReportInterval   time.Duration `yaml:"throughputReportInterval"`
+
+	KnownProtocolNames []string `yaml:"knownProtocolNames"`
+
+	TokenDecimals map[string]int `yaml:"tokenDecimals"`
+
+	ChainID  int64    `yaml:"chainId"`
+	IDFormat IDFormat `yaml:"idFormat"`
+
+	KafkaBrokers []string `yaml:"kafkaBrokers"`
+	KafkaTopic   string   `yaml:"kafkaTopic"`
+
+	BackfillRanges map[string]BlockRange `yaml:"backfillRanges"`
+
+	Networks []NetworkEndpoint `yaml:"networks"`
 }
 
 func LoadConfig(path string) (Config, error) {
@@ -67,60 +238,302 @@ func LoadConfig(path string) (Config, error) {
 		return cfg, err
 	}
 
+	if cfg.DBType == "" {
+		cfg.DBType = DBPostgres
+	}
+
+	if cfg.InsertBatchSize <= 0 {
+		cfg.InsertBatchSize = 1000
+	}
+	if cfg.InsertBufferSize > 0 && cfg.InsertBufferInterval == 0 {
+		cfg.InsertBufferInterval = 30 * time.Second
+	}
+	if cfg.MaxBatchSize > 0 {
+		if cfg.MinBatchSize <= 0 {
+			cfg.MinBatchSize = cfg.BlockBatchSize
+		}
+		if cfg.MinBatchSize <= 0 || cfg.MinBatchSize > cfg.MaxBatchSize {
+			return cfg, fmt.Errorf("minBatchSize must be between 1 and maxBatchSize")
+		}
+	}
+
+	if cfg.HeadPollInterval == 0 {
+		cfg.HeadPollInterval = 5 * time.Second
+	}
+	if cfg.RangeDelay == 0 {
+		cfg.RangeDelay = 100 * time.Millisecond
+	}
+	if cfg.HeadPollInterval < 0 || cfg.RangeDelay < 0 {
+		return cfg, fmt.Errorf("headPollInterval and rangeDelay must be positive")
+	}
+	if cfg.MaxContractRestarts == 0 {
+		cfg.MaxContractRestarts = 10
+	}
+	if cfg.StartupJitter == 0 {
+		cfg.StartupJitter = 2 * time.Second
+	}
+	if cfg.RPCTimeout == 0 {
+		cfg.RPCTimeout = 30 * time.Second
+	}
+	if cfg.TimestampCacheSize == 0 {
+		cfg.TimestampCacheSize = 10000
+	}
+	if len(cfg.IncludeEvents) > 0 && len(cfg.ExcludeEvents) > 0 {
+		return cfg, fmt.Errorf("includeEvents and excludeEvents cannot both be set")
+	}
+	if cfg.UnknownSignatureThreshold <= 0 {
+		cfg.UnknownSignatureThreshold = 0.5
+	}
+	if cfg.MaxReorgDepth == 0 {
+		cfg.MaxReorgDepth = 100
+	}
+	if cfg.ThroughputWindow <= 0 {
+		cfg.ThroughputWindow = time.Minute
+	}
+
+	if cfg.LogSource == "" {
+		cfg.LogSource = LogSourceGetLogs
+	}
+	if cfg.LogSource != LogSourceGetLogs && cfg.LogSource != LogSourceReceipts {
+		return cfg, fmt.Errorf("unknown logSource %q", cfg.LogSource)
+	}
+
+	// The prefix is pasted into raw SQL and index names, keep it to plain identifier characters.
+	for _, c := range cfg.TablePrefix {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			return cfg, fmt.Errorf("tablePrefix %q may only contain lowercase letters, digits and underscores", cfg.TablePrefix)
+		}
+	}
+
+	if cfg.TimestampSource == "" {
+		cfg.TimestampSource = TimestampSourceRPC
+	}
+	if cfg.TimestampSource != TimestampSourceRPC && cfg.TimestampSource != TimestampSourceEstimate {
+		return cfg, fmt.Errorf("unknown timestampSource %q", cfg.TimestampSource)
+	}
+	if cfg.TimestampSource == TimestampSourceEstimate && cfg.EstimatedBlockTime <= 0 {
+		return cfg, fmt.Errorf("timestampSource estimate requires estimatedBlockTime")
+	}
+
+	if cfg.IDFormat == "" {
+		cfg.IDFormat = IDFormatTxLog
+	}
+	if cfg.IDFormat != IDFormatTxLog && cfg.IDFormat != IDFormatChainTxLog {
+		return cfg, fmt.Errorf("unknown idFormat %q", cfg.IDFormat)
+	}
+
+	if cfg.DBSSLMode == "" {
+		cfg.DBSSLMode = "prefer"
+	}
+
+	if len(cfg.KafkaBrokers) > 0 && cfg.KafkaTopic == "" {
+		cfg.KafkaTopic = "whizy-events"
+	}
+
+	for name, r := range cfg.BackfillRanges {
+		if r.ToBlock < r.FromBlock {
+			return cfg, fmt.Errorf("invalid backfill range for %s: toBlock %d is before fromBlock %d", name, r.ToBlock, r.FromBlock)
+		}
+	}
+
+	decimals := make(map[string]int, len(cfg.TokenDecimals))
+	for address, d := range cfg.TokenDecimals {
+		if !common.IsHexAddress(address) || d < 0 {
+			return cfg, fmt.Errorf("invalid tokenDecimals entry %s: %d", address, d)
+		}
+		decimals[strings.ToLower(address)] = d
+	}
+	cfg.TokenDecimals = decimals
+
+	for _, network := range cfg.Networks {
+		if network.Name == "" || network.RPCEndpoint == "" {
+			return cfg, fmt.Errorf("each entry in networks needs a name and rpcEndpoint")
+		}
+	}
+	if cfg.IDFormat == IDFormatChainTxLog {
+		for _, network := range cfg.IndexedNetworks() {
+			if network.ChainID == 0 {
+				return cfg, fmt.Errorf("idFormat %q requires chainId for network %s", cfg.IDFormat, network.Name)
+			}
+		}
+	}
+
 	if cfg.NetworksFile != "" {
-		if err := LoadNetworks(cfg.NetworksFile, cfg.Network); err != nil {
+		if err := LoadNetworks(cfg.NetworksFile, cfg.NetworkNames()...); err != nil {
 			return cfg, fmt.Errorf("failed to load networks: %w", err)
 		}
+	} else if len(DefaultNetworks) > 0 {
+		fmt.Println("No networksFile configured, using embedded networks")
+		if err := LoadNetworksData(DefaultNetworks, cfg.NetworkNames()...); err != nil {
+			return cfg, fmt.Errorf("failed to load embedded networks: %w", err)
+		}
+	}
+	for _, network := range cfg.IndexedNetworks() {
+		SetChainID(network.Name, network.ChainID)
 	}
 
 	return cfg, nil
 }
 
-func LoadNetworks(networksFile, network string) error {
-	data, err := os.ReadFile(networksFile)
+var DefaultNetworks []byte
+
+const networksFetchTimeout = 30 * time.Second
+
+func LoadNetworks(networksFile string, networks ...string) error {
+	data, err := readNetworksFile(networksFile)
 	if err != nil {
 		return fmt.Errorf("failed to read networks file: %w", err)
 	}
+	return LoadNetworksData(data, networks...)
+}
 
-	var networks NetworkConfig
-	if err := json.Unmarshal(data, &networks); err != nil {
+func readNetworksFile(networksFile string) ([]byte, error) {
+	if !strings.HasPrefix(networksFile, "http://") && !strings.HasPrefix(networksFile, "https://") {
+		return os.ReadFile(networksFile)
+	}
+
+	client := http.Client{Timeout: networksFetchTimeout}
+	resp, err := client.Get(networksFile)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, networksFile)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func LoadNetworksData(data []byte, networks ...string) error {
+	WhizyPredictionMarketContract = Contract{}
+	ProtocolSelectorContract = Contract{}
+	RebalancerDelegationContract = Contract{}
+	Contracts = nil
+	NetworkContracts = nil
+
+	var config NetworkConfig
+	if err := json.Unmarshal(data, &config); err != nil {
 		return fmt.Errorf("failed to parse networks file: %w", err)
 	}
 
-	networkContracts, ok := networks[network]
+	var all []Contract
+	byNetwork := make(map[string][]Contract)
+	owners := make(map[string]string)
+
+	for _, network := range networks {
+		if _, ok := byNetwork[network]; ok {
+			return fmt.Errorf("network %s is listed more than once", network)
+		}
+
+		contracts, err := networkContracts(config, network)
+		if err != nil {
+			return err
+		}
+
+		for _, contract := range contracts {
+			owner := network + "/" + contract.Name
+			if other, ok := owners[contract.Address]; ok {
+				return fmt.Errorf("contracts %s and %s share address %s", other, owner, contract.Address)
+			}
+			owners[contract.Address] = owner
+		}
+
+		byNetwork[network] = contracts
+		all = append(all, contracts...)
+	}
+
+	if len(networks) > 0 {
+		for _, contract := range byNetwork[networks[0]] {
+			switch contract.Name {
+			case "WhizyPredictionMarket":
+				WhizyPredictionMarketContract = contract
+			case "ProtocolSelector":
+				ProtocolSelectorContract = contract
+			case "RebalancerDelegation":
+				RebalancerDelegationContract = contract
+			}
+		}
+	}
+	Contracts = all
+	NetworkContracts = byNetwork
+
+	return nil
+}
+
+func networkContracts(networks NetworkConfig, network string) ([]Contract, error) {
+	definitions, ok := networks[network]
 	if !ok {
-		return fmt.Errorf("network %s not found in networks file", network)
+		return nil, fmt.Errorf("network %s not found in networks file", network)
 	}
 
-	Contracts = []Contract{}
+	var contracts []Contract
+	for name, config := range definitions {
+		if !common.IsHexAddress(config.Address) {
+			return nil, fmt.Errorf("invalid address %q for contract %s", config.Address, name)
+		}
 
-	for name, config := range networkContracts {
 		contract := Contract{
-			Name:       name,
-			Address:    config.Address,
-			StartBlock: config.StartBlock,
+			Name:             name,
+			Network:          network,
+			Address:          common.HexToAddress(config.Address).Hex(),
+			StartBlock:       config.StartBlock,
+			ABIVersions:      config.ABIVersions,
+			Enabled:          config.Enabled == nil || *config.Enabled,
+			EventStartBlocks: config.EventStartBlocks,
+			RPCEndpoint:      config.RPCEndpoint,
+		}
+		sort.Slice(contract.ABIVersions, func(i, j int) bool {
+			return contract.ABIVersions[i].FromBlock < contract.ABIVersions[j].FromBlock
+		})
+		for _, version := range contract.ABIVersions {
+			for event, layout := range version.Layouts {
+				for column, field := range layout {
+					if field.Offset < 0 || field.Length < 1 || field.Length > 32 {
+						return nil, fmt.Errorf("invalid layout for %s.%s in abi version %s of %s: offset %d, length %d",
+							event, column, version.Name, name, field.Offset, field.Length)
+					}
+				}
+			}
 		}
 
-		switch name {
-		case "WhizyPredictionMarket":
-			WhizyPredictionMarketContract = contract
-		case "ProtocolSelector":
-			ProtocolSelectorContract = contract
-		case "RebalancerDelegation":
-			RebalancerDelegationContract = contract
+		if config.HeadPollInterval != "" {
+			d, err := time.ParseDuration(config.HeadPollInterval)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid headPollInterval %q for %s", config.HeadPollInterval, name)
+			}
+			contract.HeadPollInterval = d
 		}
+		if config.RangeDelay != "" {
+			d, err := time.ParseDuration(config.RangeDelay)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid rangeDelay %q for %s", config.RangeDelay, name)
+			}
+			contract.RangeDelay = d
+		}
+
+		contracts = append(contracts, contract)
+	}
 
-		Contracts = append(Contracts, contract)
+	if len(contracts) == 0 {
+		return nil, fmt.Errorf("no contracts found for network %s", network)
 	}
 
-	if len(Contracts) == 0 {
-		return fmt.Errorf("no contracts found for network %s", network)
+	// Parsers and the API look these up by name, so a network without one of them cannot be indexed.
+	for _, name := range KnownContractNames {
+		if _, ok := definitions[name]; !ok {
+			return nil, fmt.Errorf("contract %s is not defined for network %s", name, network)
+		}
 	}
 
-	fmt.Printf("Loaded %d contracts for network %s\n", len(Contracts), network)
-	for _, c := range Contracts {
-		fmt.Printf("  - %s: %s (start block: %d)\n", c.Name, c.Address, c.StartBlock)
+	fmt.Printf("Loaded %d contracts for network %s\n", len(contracts), network)
+	for _, c := range contracts {
+		status := ""
+		if !c.Enabled {
+			status = ", disabled"
+		}
+		fmt.Printf("  - %s: %s (start block: %d%s)\n", c.Name, c.Address, c.StartBlock, status)
 	}
 
-	return nil
+	return contracts, nil
 }
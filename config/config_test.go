@@ -0,0 +1,61 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const testNetworks = `{
+  "net-a": {
+    "WhizyPredictionMarket": {"address": "0x00000000000000000000000000000000000000a1", "startBlock": 1},
+    "ProtocolSelector": {"address": "0x00000000000000000000000000000000000000a2", "startBlock": 1},
+    "RebalancerDelegation": {"address": "0x00000000000000000000000000000000000000a3", "startBlock": 1}
+  },
+  "net-b": {
+    "WhizyPredictionMarket": {"address": "0x00000000000000000000000000000000000000b1", "startBlock": 2},
+    "ProtocolSelector": {"address": "0x00000000000000000000000000000000000000b2", "startBlock": 2},
+    "RebalancerDelegation": {"address": "0x00000000000000000000000000000000000000b3", "startBlock": 2}
+  },
+  "partial": {
+    "WhizyPredictionMarket": {"address": "0x00000000000000000000000000000000000000c1", "startBlock": 3}
+  }
+}`
+
+func TestLoadNetworksDataRequiresKnownContracts(t *testing.T) {
+	err := LoadNetworksData([]byte(testNetworks), "partial")
+	if err == nil || !strings.Contains(err.Error(), "ProtocolSelector") {
+		t.Fatalf("loading a network without ProtocolSelector returned %v", err)
+	}
+	if WhizyPredictionMarketContract.Address != "" || len(Contracts) != 0 || len(NetworkContracts) != 0 {
+		t.Errorf("failed load left contracts behind: %+v", Contracts)
+	}
+}
+
+func TestLoadNetworksDataReplacesPreviousNetwork(t *testing.T) {
+	if err := LoadNetworksData([]byte(testNetworks), "net-a"); err != nil {
+		t.Fatalf("load net-a: %v", err)
+	}
+	if WhizyPredictionMarketContract.Network != "net-a" {
+		t.Fatalf("prediction market loaded from %q", WhizyPredictionMarketContract.Network)
+	}
+
+	if err := LoadNetworksData([]byte(testNetworks), "net-b"); err != nil {
+		t.Fatalf("load net-b: %v", err)
+	}
+	for _, contract := range []Contract{WhizyPredictionMarketContract, ProtocolSelectorContract, RebalancerDelegationContract} {
+		if contract.Network != "net-b" || !strings.HasPrefix(strings.ToLower(contract.Address), "0x00000000000000000000000000000000000000b") {
+			t.Errorf("%s still points at %s %s", contract.Name, contract.Network, contract.Address)
+		}
+	}
+	if _, ok := NetworkContracts["net-a"]; ok || len(Contracts) != 3 {
+		t.Errorf("net-a contracts were not cleared: %d contracts, networks %v", len(Contracts), NetworkContracts)
+	}
+
+	// A failed reload must not keep the singletons of the previous network either.
+	if err := LoadNetworksData([]byte(testNetworks), "partial"); err == nil {
+		t.Fatal("loading partial network succeeded")
+	}
+	if ProtocolSelectorContract.Address != "" || RebalancerDelegationContract.Address != "" {
+		t.Errorf("stale singletons after failed load: %s, %s", ProtocolSelectorContract.Address, RebalancerDelegationContract.Address)
+	}
+}
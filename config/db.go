@@ -1,18 +1,28 @@
 package config
 
 import (
+	"context"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"math/big"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
 )
 
 var (
@@ -24,22 +34,31 @@ var (
 func GetDBInstance() (*gorm.DB, error) {
 	var err error
 	dbOnce.Do(func() {
-		var dsn string
-		if CFG.DBPass != "" {
-			dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=prefer",
-				CFG.DBHost, CFG.DBPort, CFG.DBUser, CFG.DBPass, CFG.DBName)
-		} else {
-			dsn = fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=prefer",
-				CFG.DBHost, CFG.DBPort, CFG.DBUser, CFG.DBName)
+		var dialector gorm.Dialector
+		dialector, err = openDialector(CFG)
+		if err != nil {
+			return
+		}
+
+		var level logger.LogLevel
+		level, err = dbLogLevel(CFG.DBLogLevel)
+		if err != nil {
+			return
+		}
+
+		colorful := isTerminal(os.Stdout)
+		if CFG.DBLogColor != nil {
+			colorful = *CFG.DBLogColor
 		}
 
-		DBInstance, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+		DBInstance, err = gorm.Open(dialector, &gorm.Config{
+			NamingStrategy: schema.NamingStrategy{TablePrefix: CFG.TablePrefix},
 			Logger: logger.New(
 				log.New(os.Stdout, "\r\n", log.LstdFlags),
 				logger.Config{
 					SlowThreshold: 0,
-					LogLevel:      logger.Warn,
-					Colorful:      true,
+					LogLevel:      level,
+					Colorful:      colorful,
 				},
 			),
 		})
@@ -47,24 +66,172 @@ func GetDBInstance() (*gorm.DB, error) {
 	return DBInstance, err
 }
 
+func dbLogLevel(level string) (logger.LogLevel, error) {
+	switch strings.ToLower(level) {
+	case "silent":
+		return logger.Silent, nil
+	case "error":
+		return logger.Error, nil
+	case "", "warn":
+		return logger.Warn, nil
+	case "info":
+		return logger.Info, nil
+	}
+	return 0, fmt.Errorf("unknown dbLogLevel %q", level)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func CloseDB() error {
+	if DBInstance == nil {
+		return nil
+	}
+
+	sqlDB, err := DBInstance.DB()
+	if err != nil {
+		return err
+	}
+
+	err = sqlDB.Close()
+	DBInstance = nil
+	dbOnce = sync.Once{}
+	return err
+}
+
+func openDialector(cfg Config) (gorm.Dialector, error) {
+	switch cfg.DBType {
+	case DBPostgres:
+		dsn := fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=%s",
+			cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBName, cfg.DBSSLMode)
+		if cfg.DBPass != "" {
+			dsn += fmt.Sprintf(" password=%s", cfg.DBPass)
+		}
+		if cfg.DBSSLRootCert != "" {
+			dsn += fmt.Sprintf(" sslrootcert=%s", cfg.DBSSLRootCert)
+		}
+		return postgres.Open(dsn), nil
+	case DBSQLite:
+		return sqlite.Open(cfg.DBName), nil
+	case DBMySQL:
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
+			cfg.DBUser, cfg.DBPass, cfg.DBHost, cfg.DBPort, cfg.DBName)
+		switch cfg.DBSSLMode {
+		case "disable":
+		case "require":
+			dsn += "&tls=skip-verify"
+		case "verify-ca", "verify-full":
+			dsn += "&tls=true"
+		default:
+			dsn += "&tls=preferred"
+		}
+		return mysql.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", cfg.DBType)
+	}
+}
+
+func TruncateTableSQL(db *gorm.DB, table string) string {
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return fmt.Sprintf("DELETE FROM %s;", table)
+	case "mysql":
+		return fmt.Sprintf("TRUNCATE TABLE %s;", table)
+	default:
+		return fmt.Sprintf("TRUNCATE TABLE %s RESTART IDENTITY CASCADE;", table)
+	}
+}
+
 func GetTableName(db *gorm.DB, model interface{}) string {
 	stmt := &gorm.Statement{DB: db}
 	stmt.Parse(model)
 	return stmt.Schema.Table
 }
 
-type Principals map[BigInt]BigInt
+func BackfillBlockTimes(db *gorm.DB) error {
+	var expr string
+	switch db.Dialector.Name() {
+	case "postgres":
+		expr = "to_timestamp(block_timestamp::double precision)"
+	case "mysql":
+		expr = "FROM_UNIXTIME(block_timestamp)"
+	default:
+		expr = "datetime(block_timestamp, 'unixepoch')"
+	}
+
+	for _, model := range append(EventTables(), &RawEvent{}) {
+		result := db.Model(model).
+			Where("block_time IS NULL AND block_timestamp > 0").
+			Update("block_time", gorm.Expr(expr))
+		if result.Error != nil {
+			return fmt.Errorf("failed to backfill block_time for %s: %w", GetTableName(db, model), result.Error)
+		}
+		if result.RowsAffected > 0 {
+			fmt.Printf("Backfilled block_time for %d rows in %s\n", result.RowsAffected, GetTableName(db, model))
+		}
+	}
+	return nil
+}
+
+// Principals maps a market id, in decimal, to its amount. BigInt keys would compare by pointer.
+type Principals map[string]BigInt
 
 func (p Principals) Value() (driver.Value, error) {
-	return json.Marshal(p)
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
 }
 
 func (p *Principals) Scan(src interface{}) error {
-	bytes, ok := src.([]byte)
-	if !ok {
+	switch v := src.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
 		return fmt.Errorf("unable to scan Principals, src is %T", src)
 	}
-	return json.Unmarshal(bytes, p)
+}
+
+func (b BigInt) FormatUnits(decimals int) string {
+	if decimals <= 0 {
+		return b.String()
+	}
+
+	digits := new(big.Int).Abs(b.orZero()).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-decimals], strings.TrimRight(digits[len(digits)-decimals:], "0")
+
+	result := whole
+	if fraction != "" {
+		result += "." + fraction
+	}
+	if b.Sign() < 0 {
+		result = "-" + result
+	}
+	return result
+}
+
+func (b BigInt) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b *BigInt) UnmarshalText(text []byte) error {
+	bi, ok := new(big.Int).SetString(string(text), 10)
+	if !ok {
+		return fmt.Errorf("BigInt: cannot parse %q", text)
+	}
+	b.Int = bi
+	return nil
 }
 
 func (b BigInt) MarshalJSON() ([]byte, error) {
@@ -76,12 +243,14 @@ func (b BigInt) MarshalJSON() ([]byte, error) {
 
 func (b *BigInt) UnmarshalJSON(data []byte) error {
 	if len(data) == 0 || string(data) == "null" {
-		b.Int = big.NewInt(0)
+		b.Int = nil
 		return nil
 	}
-	var s string
-	if err := json.Unmarshal(data, &s); err != nil {
-		return err
+	s := string(data)
+	if data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
 	}
 	bi, ok := new(big.Int).SetString(s, 10)
 	if !ok {
@@ -98,9 +267,16 @@ type BetPlaced struct {
 	Position        bool   `gorm:"column:position;not null"`
 	Amount          BigInt `gorm:"column:amount;type:NUMERIC;not null"`
 	Shares          BigInt `gorm:"column:shares;type:NUMERIC;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type MarketCreated struct {
@@ -110,18 +286,32 @@ type MarketCreated struct {
 	EndTime         BigInt `gorm:"column:end_time;type:NUMERIC;not null"`
 	TokenAddress    string `gorm:"column:token_address;not null"`
 	VaultAddress    string `gorm:"column:vault_address;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type MarketResolved struct {
 	ID              string `gorm:"primaryKey;column:id"`
 	MarketID        BigInt `gorm:"column:market_id;type:NUMERIC;not null;index"`
 	Outcome         bool   `gorm:"column:outcome;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type WinningsClaimed struct {
@@ -129,9 +319,16 @@ type WinningsClaimed struct {
 	MarketID        BigInt `gorm:"column:market_id;type:NUMERIC;not null;index"`
 	User            string `gorm:"column:user;not null;index"`
 	WinningAmount   BigInt `gorm:"column:winning_amount;type:NUMERIC;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type AutoDepositExecuted struct {
@@ -140,9 +337,16 @@ type AutoDepositExecuted struct {
 	Protocol        string `gorm:"column:protocol;not null"`
 	Amount          BigInt `gorm:"column:amount;type:NUMERIC;not null"`
 	Success         bool   `gorm:"column:success;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type AutoWithdrawExecuted struct {
@@ -151,37 +355,65 @@ type AutoWithdrawExecuted struct {
 	Protocol        string `gorm:"column:protocol;not null"`
 	Amount          BigInt `gorm:"column:amount;type:NUMERIC;not null"`
 	Success         bool   `gorm:"column:success;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type OwnershipTransferred struct {
 	ID              string `gorm:"primaryKey;column:id"`
 	PreviousOwner   string `gorm:"column:previous_owner;not null"`
 	NewOwner        string `gorm:"column:new_owner;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type Paused struct {
 	ID              string `gorm:"primaryKey;column:id"`
 	Account         string `gorm:"column:account;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type ProtocolRegistered struct {
-	ID              string `gorm:"primaryKey;column:id"`
-	ProtocolType    int    `gorm:"column:protocol_type;not null"`
-	ProtocolAddress string `gorm:"column:protocol_address;not null;index"`
-	Name            string `gorm:"column:name;not null"`
-	RiskLevel       int    `gorm:"column:risk_level;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
-	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
-	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	ID              string       `gorm:"primaryKey;column:id"`
+	ProtocolType    ProtocolType `gorm:"column:protocol_type;not null"`
+	ProtocolAddress string       `gorm:"column:protocol_address;not null;index"`
+	Name            string       `gorm:"column:name;not null"`
+	RiskLevel       RiskLevel    `gorm:"column:risk_level;not null"`
+	BlockNumber     BigInt       `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint         `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string       `gorm:"column:block_hash;index"`
+	BlockTimestamp  BigInt       `gorm:"column:block_timestamp;type:NUMERIC;not null"`
+	TransactionHash string       `gorm:"column:transaction_hash;not null;index"`
+	Environment     string       `gorm:"column:environment;index"`
+	Finalized       bool         `gorm:"column:finalized;not null;default:false;index"`
+	Network         string       `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type ProtocolUpdated struct {
@@ -189,52 +421,94 @@ type ProtocolUpdated struct {
 	ProtocolAddress string `gorm:"column:protocol_address;not null;index"`
 	NewApy          BigInt `gorm:"column:new_apy;type:NUMERIC;not null"`
 	NewTvl          BigInt `gorm:"column:new_tvl;type:NUMERIC;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type Unpaused struct {
 	ID              string `gorm:"primaryKey;column:id"`
 	Account         string `gorm:"column:account;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type AutoRebalanceEnabled struct {
-	ID              string `gorm:"primaryKey;column:id"`
-	User            string `gorm:"column:user;not null;index"`
-	RiskProfile     int    `gorm:"column:risk_profile;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
-	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
-	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	ID              string      `gorm:"primaryKey;column:id"`
+	User            string      `gorm:"column:user;not null;index"`
+	RiskProfile     RiskProfile `gorm:"column:risk_profile;not null"`
+	BlockNumber     BigInt      `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint        `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string      `gorm:"column:block_hash;index"`
+	BlockTimestamp  BigInt      `gorm:"column:block_timestamp;type:NUMERIC;not null"`
+	TransactionHash string      `gorm:"column:transaction_hash;not null;index"`
+	Environment     string      `gorm:"column:environment;index"`
+	Finalized       bool        `gorm:"column:finalized;not null;default:false;index"`
+	Network         string      `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type AutoRebalanceDisabled struct {
 	ID              string `gorm:"primaryKey;column:id"`
 	User            string `gorm:"column:user;not null;index"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type Deposited struct {
 	ID              string `gorm:"primaryKey;column:id"`
 	User            string `gorm:"column:user;not null;index"`
 	Amount          BigInt `gorm:"column:amount;type:NUMERIC;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type Withdrawn struct {
 	ID              string `gorm:"primaryKey;column:id"`
 	User            string `gorm:"column:user;not null;index"`
 	Amount          BigInt `gorm:"column:amount;type:NUMERIC;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type Rebalanced struct {
@@ -242,77 +516,368 @@ type Rebalanced struct {
 	User            string `gorm:"column:user;not null;index"`
 	Operator        string `gorm:"column:operator;not null;index"`
 	Amount          BigInt `gorm:"column:amount;type:NUMERIC;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type OperatorAdded struct {
 	ID              string `gorm:"primaryKey;column:id"`
 	Operator        string `gorm:"column:operator;not null;index"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type OperatorRemoved struct {
 	ID              string `gorm:"primaryKey;column:id"`
 	Operator        string `gorm:"column:operator;not null;index"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type MarketVaultRebalanced struct {
 	ID              string `gorm:"primaryKey;column:id"`
 	MarketID        BigInt `gorm:"column:market_id;type:NUMERIC;not null;index"`
 	Amount          BigInt `gorm:"column:amount;type:NUMERIC;not null"`
-	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
 	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
 	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
+}
+
+type BatchRebalanced struct {
+	ID              string     `gorm:"primaryKey;column:id"`
+	Principals      Principals `gorm:"column:principals;type:TEXT;not null"`
+	BlockNumber     BigInt     `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint       `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string     `gorm:"column:block_hash;index"`
+	BlockTimestamp  BigInt     `gorm:"column:block_timestamp;type:NUMERIC;not null"`
+	TransactionHash string     `gorm:"column:transaction_hash;not null;index"`
+	Environment     string     `gorm:"column:environment;index"`
+	Finalized       bool       `gorm:"column:finalized;not null;default:false;index"`
+	Network         string     `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
 }
 
 type BigInt struct {
 	*big.Int
 }
 
-func (b BigInt) Value() (driver.Value, error) {
+func NewBigInt(i int64) BigInt {
+	return BigInt{Int: big.NewInt(i)}
+}
+
+func (b BigInt) orZero() *big.Int {
 	if b.Int == nil {
-		return "0", nil
+		return new(big.Int)
 	}
+	return b.Int
+}
+
+func (b BigInt) String() string {
+	return b.orZero().String()
+}
+
+func (b BigInt) Format(s fmt.State, verb rune) {
+	b.orZero().Format(s, verb)
+}
+
+func (b BigInt) Sign() int {
+	return b.orZero().Sign()
+}
+
+func (b BigInt) Int64() int64 {
+	return b.orZero().Int64()
+}
+
+func (b BigInt) Uint64() uint64 {
+	return b.orZero().Uint64()
+}
+
+func (b BigInt) Cmp(other BigInt) int {
+	return b.orZero().Cmp(other.orZero())
+}
+
+func (b BigInt) Add(other BigInt) BigInt {
+	return BigInt{Int: new(big.Int).Add(b.orZero(), other.orZero())}
+}
+
+func (b BigInt) Value() (driver.Value, error) {
 	return b.String(), nil
 }
 
+// Block numbers and timestamps fit in 64 bits, every other BigInt column may hold a full uint256.
+var integerBigIntColumns = map[string]bool{
+	"block_number":    true,
+	"block_timestamp": true,
+}
+
+// uint256 has at most 78 decimal digits.
+const bigIntTextWidth = 78
+
+func (BigInt) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	integer := integerBigIntColumns[field.DBName]
+	switch db.Dialector.Name() {
+	case "sqlite":
+		if integer {
+			return "INTEGER"
+		}
+		return "TEXT"
+	case "mysql":
+		if integer {
+			return "BIGINT"
+		}
+		// DECIMAL stops at 65 digits, so wide values are stored as zero-padded text which still sorts numerically.
+		return fmt.Sprintf("VARCHAR(%d)", bigIntTextWidth)
+	}
+	return ""
+}
+
+func (b BigInt) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	switch db.Dialector.Name() {
+	case "sqlite", "mysql":
+		return clause.Expr{SQL: "?", Vars: []interface{}{b.paddedString()}}
+	}
+	return clause.Expr{SQL: "?", Vars: []interface{}{b.String()}}
+}
+
+func (b BigInt) paddedString() string {
+	digits := new(big.Int).Abs(b.orZero()).String()
+	if len(digits) < bigIntTextWidth {
+		digits = strings.Repeat("0", bigIntTextWidth-len(digits)) + digits
+	}
+	if b.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+func PadBigIntColumns(db *gorm.DB, models ...interface{}) error {
+	var expr string
+	switch db.Dialector.Name() {
+	case "sqlite":
+		expr = fmt.Sprintf("substr('%s' || %%[1]s, -%d)", strings.Repeat("0", bigIntTextWidth), bigIntTextWidth)
+	case "mysql":
+		expr = fmt.Sprintf("LPAD(%%[1]s, %d, '0')", bigIntTextWidth)
+	default:
+		return nil
+	}
+
+	bigIntType := reflect.TypeOf(BigInt{})
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.FieldType != bigIntType || field.DBName == "" || integerBigIntColumns[field.DBName] {
+				continue
+			}
+			// Rows written before values were padded would otherwise compare as plain strings.
+			column := db.Statement.Quote(field.DBName)
+			result := db.Table(stmt.Schema.Table).
+				Where(fmt.Sprintf("LENGTH(%[1]s) < ? AND %[1]s NOT LIKE ?", column), bigIntTextWidth, "-%").
+				Update(field.DBName, gorm.Expr(fmt.Sprintf(expr, column)))
+			if result.Error != nil {
+				return fmt.Errorf("failed to pad %s.%s: %w", stmt.Schema.Table, field.DBName, result.Error)
+			}
+			if result.RowsAffected > 0 {
+				fmt.Printf("Padded %d %s values in %s\n", result.RowsAffected, field.DBName, stmt.Schema.Table)
+			}
+		}
+	}
+	return nil
+}
+
 func (b *BigInt) Scan(value interface{}) error {
+	// NULL stays nil like a JSON null, the accessors already read nil as zero.
 	if value == nil {
-		b.Int = big.NewInt(0)
+		b.Int = nil
 		return nil
 	}
 	switch v := value.(type) {
 	case []byte:
-		s := string(v)
-		i, ok := new(big.Int).SetString(s, 10)
-		if !ok {
-			return fmt.Errorf("cannot convert %s to big.Int", s)
+		i, err := parseNumeric(string(v))
+		if err != nil {
+			return err
 		}
 		b.Int = i
 	case string:
-		i, ok := new(big.Int).SetString(v, 10)
-		if !ok {
-			return fmt.Errorf("cannot convert %s to big.Int", v)
+		i, err := parseNumeric(v)
+		if err != nil {
+			return err
 		}
 		b.Int = i
+	case int64:
+		b.Int = big.NewInt(v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) || v != math.Trunc(v) {
+			return fmt.Errorf("cannot convert non-integer %v to big.Int", v)
+		}
+		b.Int, _ = big.NewFloat(v).Int(nil)
 	default:
 		return fmt.Errorf("unsupported type: %T", value)
 	}
 	return nil
 }
 
+// Aggregates over NUMERIC columns may come back with a zero fraction, e.g. "42.000".
+func parseNumeric(s string) (*big.Int, error) {
+	if whole, fraction, ok := strings.Cut(s, "."); ok && strings.Trim(fraction, "0") == "" {
+		s = whole
+	}
+	i, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %s to big.Int", s)
+	}
+	return i, nil
+}
+
+type RawEvent struct {
+	ID              string `gorm:"primaryKey;column:id"`
+	ContractAddress string `gorm:"column:contract_address;not null;index"`
+	Topics          string `gorm:"column:topics;not null"`
+	Data            string `gorm:"column:data;not null"`
+	BlockNumber     BigInt `gorm:"column:block_number;type:NUMERIC;not null;index:,composite:block_log,priority:1"`
+	LogIndex        uint   `gorm:"column:log_index;not null;default:0;index:,composite:block_log,priority:2"`
+	BlockHash       string `gorm:"column:block_hash;index"`
+	BlockTimestamp  BigInt `gorm:"column:block_timestamp;type:NUMERIC;not null"`
+	TransactionHash string `gorm:"column:transaction_hash;not null;index"`
+	Environment     string `gorm:"column:environment;index"`
+	Finalized       bool   `gorm:"column:finalized;not null;default:false;index"`
+	Network         string `gorm:"column:network;index"`
+
+	BlockTime *time.Time `gorm:"column:block_time;index"`
+}
+
+type QueuedEntity struct {
+	ID              uint   `gorm:"primaryKey;column:id"`
+	ContractAddress string `gorm:"column:contract_address;not null"`
+	EventType       string `gorm:"column:event_type;not null"`
+	Payload         string `gorm:"column:payload;not null"`
+}
+
+type DeadLetter struct {
+	ID              uint      `gorm:"primaryKey;column:id"`
+	ContractAddress string    `gorm:"column:contract_address;not null;index"`
+	EventType       string    `gorm:"column:event_type;not null"`
+	EntityID        string    `gorm:"column:entity_id;index"`
+	BlockNumber     int64     `gorm:"column:block_number"`
+	Payload         string    `gorm:"column:payload;not null"`
+	Error           string    `gorm:"column:error;not null"`
+	CreatedAt       time.Time `gorm:"column:created_at"`
+}
+
+type ScannedRange struct {
+	ContractAddress string    `gorm:"primaryKey;column:contract_address"`
+	FromBlock       int64     `gorm:"primaryKey;column:from_block"`
+	ToBlock         int64     `gorm:"column:to_block;not null"`
+	ScannedAt       time.Time `gorm:"column:scanned_at"`
+}
+
+type BlockEventStats struct {
+	ContractAddress string `gorm:"primaryKey;column:contract_address"`
+	BlockNumber     int64  `gorm:"primaryKey;autoIncrement:false;column:block_number"`
+	EventType       string `gorm:"primaryKey;column:event_type"`
+	Count           int64  `gorm:"column:count;not null"`
+}
+
+var ContractTables = map[string][]interface{}{
+	"WhizyPredictionMarket": {
+		&BetPlaced{},
+		&MarketCreated{},
+		&MarketResolved{},
+		&WinningsClaimed{},
+		&MarketVaultRebalanced{},
+		&BatchRebalanced{},
+	},
+	"ProtocolSelector": {
+		&AutoDepositExecuted{},
+		&AutoWithdrawExecuted{},
+		&OwnershipTransferred{},
+		&Paused{},
+		&ProtocolRegistered{},
+		&ProtocolUpdated{},
+		&Unpaused{},
+	},
+	"RebalancerDelegation": {
+		&AutoRebalanceEnabled{},
+		&AutoRebalanceDisabled{},
+		&Deposited{},
+		&Withdrawn{},
+		&Rebalanced{},
+		&OperatorAdded{},
+		&OperatorRemoved{},
+	},
+}
+
 type SyncState struct {
 	ContractAddress string `gorm:"primaryKey;column:contract_address"`
 	ContractName    string `gorm:"column:contract_name;not null"`
 	LastBlock       int64  `gorm:"column:last_block;not null"`
 	LastBlockHash   string `gorm:"column:last_block_hash"`
+	Environment     string `gorm:"column:environment;index"`
+
+	LastBlockTimestamp int64  `gorm:"column:last_block_timestamp"`
+	FinalizedBlock     int64  `gorm:"column:finalized_block"`
+	Network            string `gorm:"column:network;index"`
+	StartBlock         int64  `gorm:"column:start_block"`
+}
+
+type ContractStatus struct {
+	ContractAddress string    `gorm:"primaryKey;column:contract_address"`
+	ContractName    string    `gorm:"column:contract_name;not null"`
+	Paused          bool      `gorm:"column:paused;not null"`
+	Account         string    `gorm:"column:account"`
+	SinceBlock      int64     `gorm:"column:since_block;not null"`
+	SinceLogIndex   uint      `gorm:"column:since_log_index;not null;default:0"`
+	TransactionHash string    `gorm:"column:transaction_hash"`
+	Environment     string    `gorm:"column:environment;index"`
+	Network         string    `gorm:"column:network;index"`
+	UpdatedAt       time.Time `gorm:"column:updated_at"`
+}
+
+type ContractOwner struct {
+	ContractAddress string    `gorm:"primaryKey;column:contract_address"`
+	ContractName    string    `gorm:"column:contract_name;not null"`
+	Owner           string    `gorm:"column:owner;not null"`
+	PreviousOwner   string    `gorm:"column:previous_owner"`
+	SinceBlock      int64     `gorm:"column:since_block;not null"`
+	SinceLogIndex   uint      `gorm:"column:since_log_index;not null;default:0"`
+	TransactionHash string    `gorm:"column:transaction_hash"`
+	Environment     string    `gorm:"column:environment;index"`
+	Network         string    `gorm:"column:network;index"`
+	UpdatedAt       time.Time `gorm:"column:updated_at"`
 }
 
 func EnsureInitialSyncStateData(db *gorm.DB) {
@@ -327,14 +892,27 @@ func EnsureInitialSyncStateData(db *gorm.DB) {
 
 		err := db.First(&existing, "contract_address = ?", contract.Address).Error
 
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = db.First(&existing, "LOWER(contract_address) = LOWER(?)", contract.Address).Error
+			if err == nil {
+				fmt.Printf("Normalizing sync state address for contract %s to %s\n", contract.Name, contract.Address)
+				err = db.Model(&SyncState{}).
+					Where("contract_address = ?", existing.ContractAddress).
+					Update("contract_address", contract.Address).Error
+			}
+		}
+
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 
 				data := SyncState{
 					ContractAddress: contract.Address,
 					ContractName:    contract.Name,
+					Network:         contract.Network,
 					LastBlock:       contract.StartBlock,
 					LastBlockHash:   "",
+					Environment:     CFG.Environment,
+					StartBlock:      contract.StartBlock,
 				}
 				if err := db.Create(&data).Error; err != nil {
 					fmt.Printf("Failed to insert initial data for contract %s: %v\n", contract.Name, err)
@@ -346,6 +924,121 @@ func EnsureInitialSyncStateData(db *gorm.DB) {
 			}
 		} else {
 			fmt.Printf("Sync state already exists for contract %s (current block: %d)\n", contract.Name, existing.LastBlock)
+			if existing.Network != contract.Network {
+				if err := db.Model(&existing).Update("network", contract.Network).Error; err != nil {
+					fmt.Printf("Failed to update network for contract %s: %v\n", contract.Name, err)
+				}
+			}
 		}
 	}
 }
+
+func SetStartBlock(address string, block int64) {
+	for i := range Contracts {
+		if Contracts[i].Address == address {
+			Contracts[i].StartBlock = block
+		}
+	}
+	for _, contracts := range NetworkContracts {
+		for i := range contracts {
+			if contracts[i].Address == address {
+				contracts[i].StartBlock = block
+			}
+		}
+	}
+}
+
+func SetChainID(network string, chainID int64) {
+	for i := range Contracts {
+		if Contracts[i].Network == network {
+			Contracts[i].ChainID = chainID
+		}
+	}
+	for i := range NetworkContracts[network] {
+		NetworkContracts[network][i].ChainID = chainID
+	}
+}
+
+func ParseStartBlockOverrides(value string) (map[string]int64, error) {
+	overrides := make(map[string]int64)
+	if value == "" {
+		return overrides, nil
+	}
+
+	for _, part := range strings.Split(value, ",") {
+		name, block := "", strings.TrimSpace(part)
+		if i := strings.Index(block, "="); i >= 0 {
+			name, block = strings.TrimSpace(block[:i]), strings.TrimSpace(block[i+1:])
+		}
+
+		number, err := strconv.ParseInt(block, 10, 64)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("invalid start block %q", part)
+		}
+		overrides[name] = number
+	}
+
+	return overrides, nil
+}
+
+func ApplyStartBlockOverrides(db *gorm.DB, overrides map[string]int64) error {
+	for name := range overrides {
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, contract := range Contracts {
+			if contract.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("start block override for unknown contract %s", name)
+		}
+	}
+
+	for i, contract := range Contracts {
+		block, ok := overrides[contract.Name]
+		if !ok {
+			block, ok = overrides[""]
+		}
+		if !ok {
+			continue
+		}
+		Contracts[i].StartBlock = block
+
+		var existing SyncState
+		err := db.First(&existing, "contract_address = ?", contract.Address).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read sync state for %s: %w", contract.Name, err)
+		}
+
+		fmt.Printf("Resetting sync state for contract %s from block %d to %d\n", contract.Name, existing.LastBlock, block)
+		updates := map[string]interface{}{"last_block": block, "last_block_hash": ""}
+		if existing.FinalizedBlock > block {
+			updates["finalized_block"] = block
+		}
+		if err := db.Model(&existing).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to reset sync state for %s: %w", contract.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func AssignDefaultNetwork(db *gorm.DB, network string) error {
+	for _, model := range append(EventTables(), &RawEvent{}) {
+		result := db.Model(model).Where("network = ? OR network IS NULL", "").Update("network", network)
+		if result.Error != nil {
+			return fmt.Errorf("failed to assign network to %s: %w", GetTableName(db, model), result.Error)
+		}
+		if result.RowsAffected > 0 {
+			fmt.Printf("Assigned network %s to %d rows in %s\n", network, result.RowsAffected, GetTableName(db, model))
+		}
+	}
+	return nil
+}
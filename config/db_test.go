@@ -0,0 +1,293 @@
+package config
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	return db
+}
+
+func TestBigIntDataTypePerDialect(t *testing.T) {
+	s, err := schema.Parse(&BetPlaced{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+
+	tests := []struct {
+		dialector gorm.Dialector
+		column    string
+		want      string
+	}{
+		{sqlite.Open(":memory:"), "block_number", "INTEGER"},
+		{sqlite.Open(":memory:"), "block_timestamp", "INTEGER"},
+		{sqlite.Open(":memory:"), "amount", "TEXT"},
+		{mysql.New(mysql.Config{}), "block_number", "BIGINT"},
+		{mysql.New(mysql.Config{}), "block_timestamp", "BIGINT"},
+		{mysql.New(mysql.Config{}), "amount", "VARCHAR(78)"},
+		{postgres.New(postgres.Config{}), "block_number", ""},
+		{postgres.New(postgres.Config{}), "amount", ""},
+	}
+	for _, tt := range tests {
+		db := &gorm.DB{Config: &gorm.Config{Dialector: tt.dialector}}
+		got := BigInt{}.GormDBDataType(db, s.LookUpField(tt.column))
+		if got != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.dialector.Name(), tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestBigIntColumnsCompareNumericallyOnSQLite(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&BetPlaced{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	maxUint256 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	amounts := []*big.Int{big.NewInt(10), maxUint256, big.NewInt(9), big.NewInt(100)}
+	for i, amount := range amounts {
+		bet := BetPlaced{
+			ID:              strings.Repeat("a", i+1),
+			MarketID:        BigInt{Int: big.NewInt(1)},
+			Amount:          BigInt{Int: amount},
+			Shares:          BigInt{Int: amount},
+			BlockNumber:     BigInt{Int: big.NewInt(int64(10 - i))},
+			BlockTimestamp:  BigInt{Int: big.NewInt(1700000000)},
+			TransactionHash: "0x1",
+		}
+		if err := db.Create(&bet).Error; err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	var byAmount []BetPlaced
+	if err := db.Where("amount > ?", BigInt{Int: big.NewInt(9)}).Order("amount").Find(&byAmount).Error; err != nil {
+		t.Fatalf("query amounts: %v", err)
+	}
+	want := []*big.Int{big.NewInt(10), big.NewInt(100), maxUint256}
+	if len(byAmount) != len(want) {
+		t.Fatalf("got %d rows above 9, want %d", len(byAmount), len(want))
+	}
+	for i, bet := range byAmount {
+		if bet.Amount.Int.Cmp(want[i]) != 0 {
+			t.Errorf("row %d: amount %s, want %s", i, bet.Amount, want[i])
+		}
+	}
+
+	var byBlock []BetPlaced
+	if err := db.Where("block_number >= ?", 8).Order("block_number").Find(&byBlock).Error; err != nil {
+		t.Fatalf("query blocks: %v", err)
+	}
+	if len(byBlock) != 3 || byBlock[0].BlockNumber.Int64() != 8 || byBlock[2].BlockNumber.Int64() != 10 {
+		t.Errorf("unexpected block order: %+v", byBlock)
+	}
+
+	var typ string
+	if err := db.Raw("SELECT typeof(block_number) FROM bet_placeds LIMIT 1").Scan(&typ).Error; err != nil {
+		t.Fatalf("typeof: %v", err)
+	}
+	if typ != "integer" {
+		t.Errorf("block_number stored as %s, want integer", typ)
+	}
+}
+
+func TestPadBigIntColumnsRewritesLegacyRows(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&BetPlaced{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Exec("INSERT INTO bet_placeds (id, market_id, user, position, amount, shares, block_number, block_timestamp, transaction_hash) VALUES ('legacy', '7', '0x1', true, '42', '0', 1, 1, '0x1')").Error; err != nil {
+		t.Fatalf("insert legacy row: %v", err)
+	}
+
+	if err := PadBigIntColumns(db, &BetPlaced{}); err != nil {
+		t.Fatalf("pad: %v", err)
+	}
+
+	var amount string
+	if err := db.Raw("SELECT amount FROM bet_placeds WHERE id = 'legacy'").Scan(&amount).Error; err != nil {
+		t.Fatalf("read amount: %v", err)
+	}
+	if len(amount) != bigIntTextWidth || strings.TrimLeft(amount, "0") != "42" {
+		t.Errorf("amount not padded: %q", amount)
+	}
+
+	var bet BetPlaced
+	if err := db.Where("market_id = ?", BigInt{Int: big.NewInt(7)}).First(&bet).Error; err != nil {
+		t.Fatalf("lookup by padded market id: %v", err)
+	}
+	if bet.Amount.Int64() != 42 {
+		t.Errorf("amount scanned as %s, want 42", bet.Amount)
+	}
+}
+
+func TestBigIntJSONAndScanRoundTrip(t *testing.T) {
+	maxUint256 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	tests := []struct {
+		name  string
+		value *big.Int
+		json  string
+	}{
+		{"zero", big.NewInt(0), `"0"`},
+		{"nil", nil, `null`},
+		{"negative", big.NewInt(-42), `"-42"`},
+		{"max uint256", maxUint256, `"` + maxUint256.String() + `"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(BigInt{Int: tt.value})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if string(data) != tt.json {
+				t.Errorf("marshal: got %s, want %s", data, tt.json)
+			}
+
+			var fromJSON BigInt
+			if err := json.Unmarshal(data, &fromJSON); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+
+			// A NULL column is what a nil value looks like to Scan.
+			var scanned interface{}
+			if tt.value != nil {
+				scanned = []byte(tt.value.String())
+			}
+			fromDB := BigInt{Int: big.NewInt(7)}
+			if err := fromDB.Scan(scanned); err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+
+			for source, got := range map[string]BigInt{"json": fromJSON, "scan": fromDB} {
+				if tt.value == nil {
+					if got.Int != nil {
+						t.Errorf("%s: got %s, want nil", source, got.Int)
+					}
+					continue
+				}
+				if got.Int == nil || got.Int.Cmp(tt.value) != 0 {
+					t.Errorf("%s: got %v, want %s", source, got.Int, tt.value)
+				}
+			}
+		})
+	}
+}
+
+func TestPrincipalsValueScanRoundTrip(t *testing.T) {
+	maxUint256 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	tests := []struct {
+		name       string
+		principals Principals
+		want       map[string]string
+	}{
+		{"empty", Principals{}, map[string]string{}},
+		{"zero key", Principals{"0": NewBigInt(5)}, map[string]string{"0": "5"}},
+		{"multiple entries", Principals{
+			"1":                 NewBigInt(100),
+			"2":                 {Int: maxUint256},
+			maxUint256.String(): NewBigInt(0),
+		}, map[string]string{"1": "100", "2": maxUint256.String(), maxUint256.String(): "0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.principals.Value()
+			if err != nil {
+				t.Fatalf("value: %v", err)
+			}
+
+			for _, src := range []interface{}{value, []byte(value.(string))} {
+				var scanned Principals
+				if err := scanned.Scan(src); err != nil {
+					t.Fatalf("scan %T: %v", src, err)
+				}
+				got := make(map[string]string, len(scanned))
+				for k, v := range scanned {
+					got[k] = v.String()
+				}
+				if len(got) != len(tt.want) {
+					t.Fatalf("scan %T: got %v, want %v", src, got, tt.want)
+				}
+				for k, v := range tt.want {
+					if got[k] != v {
+						t.Errorf("scan %T: principal of %s is %q, want %q", src, k, got[k], v)
+					}
+				}
+			}
+		})
+	}
+
+	var scanned Principals
+	if err := scanned.Scan(nil); err != nil || scanned != nil {
+		t.Errorf("scan NULL: got %v, %v", scanned, err)
+	}
+	if err := scanned.Scan(42); err == nil {
+		t.Error("scan int: expected an error")
+	}
+}
+
+func TestBigIntScanDriverTypes(t *testing.T) {
+	maxUint256 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	padded := strings.Repeat("0", bigIntTextWidth-2) + "42"
+
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    *big.Int
+		wantErr bool
+	}{
+		{"postgres numeric bytes", []byte(maxUint256.String()), maxUint256, false},
+		{"numeric aggregate with zero fraction", []byte("42.000"), big.NewInt(42), false},
+		{"padded text", padded, big.NewInt(42), false},
+		{"negative string", "-7", big.NewInt(-7), false},
+		{"sqlite integer", int64(1700000000), big.NewInt(1700000000), false},
+		{"negative int64", int64(-3), big.NewInt(-3), false},
+		{"integral float", float64(1e18), new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil), false},
+		{"fractional text", "42.5", nil, true},
+		{"non-numeric bytes", []byte("abc"), nil, true},
+		{"non-integer float", 1.5, nil, true},
+		{"NaN", math.NaN(), nil, true},
+		{"positive infinity", math.Inf(1), nil, true},
+		{"negative infinity", math.Inf(-1), nil, true},
+		{"unsupported type", true, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b BigInt
+			err := b.Scan(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("scan %v: got %s, want an error", tt.value, b.Int)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+			if b.Int == nil || b.Int.Cmp(tt.want) != 0 {
+				t.Errorf("got %v, want %s", b.Int, tt.want)
+			}
+		})
+	}
+}
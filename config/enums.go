@@ -0,0 +1,139 @@
+package config
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+)
+
+type RiskProfile int
+
+const (
+	RiskProfileConservative RiskProfile = iota
+	RiskProfileModerate
+	RiskProfileAggressive
+)
+
+var riskProfileNames = []string{"conservative", "moderate", "aggressive"}
+
+type ProtocolType int
+
+const (
+	ProtocolTypeLending ProtocolType = iota
+	ProtocolTypeStaking
+	ProtocolTypeLiquidity
+)
+
+var protocolTypeNames = []string{"lending", "staking", "liquidity"}
+
+type RiskLevel int
+
+const (
+	RiskLevelLow RiskLevel = iota
+	RiskLevelMedium
+	RiskLevelHigh
+)
+
+var riskLevelNames = []string{"low", "medium", "high"}
+
+func (r RiskProfile) IsValid() bool  { return r >= 0 && int(r) < len(riskProfileNames) }
+func (p ProtocolType) IsValid() bool { return p >= 0 && int(p) < len(protocolTypeNames) }
+func (r RiskLevel) IsValid() bool    { return r >= 0 && int(r) < len(riskLevelNames) }
+
+func (r RiskProfile) String() string  { return enumString("RiskProfile", int(r), riskProfileNames) }
+func (p ProtocolType) String() string { return enumString("ProtocolType", int(p), protocolTypeNames) }
+func (r RiskLevel) String() string    { return enumString("RiskLevel", int(r), riskLevelNames) }
+
+func (r RiskProfile) Value() (driver.Value, error)  { return int64(r), nil }
+func (p ProtocolType) Value() (driver.Value, error) { return int64(p), nil }
+func (r RiskLevel) Value() (driver.Value, error)    { return int64(r), nil }
+
+func (r *RiskProfile) Scan(value interface{}) error {
+	v, err := scanEnum(value)
+	*r = RiskProfile(v)
+	return err
+}
+
+func (p *ProtocolType) Scan(value interface{}) error {
+	v, err := scanEnum(value)
+	*p = ProtocolType(v)
+	return err
+}
+
+func (r *RiskLevel) Scan(value interface{}) error {
+	v, err := scanEnum(value)
+	*r = RiskLevel(v)
+	return err
+}
+
+func (r RiskProfile) MarshalText() ([]byte, error)  { return []byte(r.String()), nil }
+func (p ProtocolType) MarshalText() ([]byte, error) { return []byte(p.String()), nil }
+func (r RiskLevel) MarshalText() ([]byte, error)    { return []byte(r.String()), nil }
+
+func (r *RiskProfile) UnmarshalText(text []byte) error {
+	v, err := parseEnum("RiskProfile", string(text), riskProfileNames)
+	*r = RiskProfile(v)
+	return err
+}
+
+func (p *ProtocolType) UnmarshalText(text []byte) error {
+	v, err := parseEnum("ProtocolType", string(text), protocolTypeNames)
+	*p = ProtocolType(v)
+	return err
+}
+
+func (r *RiskLevel) UnmarshalText(text []byte) error {
+	v, err := parseEnum("RiskLevel", string(text), riskLevelNames)
+	*r = RiskLevel(v)
+	return err
+}
+
+func EnumNames(v interface{}) ([]string, bool) {
+	switch v.(type) {
+	case RiskProfile:
+		return riskProfileNames, true
+	case ProtocolType:
+		return protocolTypeNames, true
+	case RiskLevel:
+		return riskLevelNames, true
+	}
+	return nil, false
+}
+
+func enumString(typeName string, v int, names []string) string {
+	if v >= 0 && v < len(names) {
+		return names[v]
+	}
+	return fmt.Sprintf("%s(%d)", typeName, v)
+}
+
+func parseEnum(typeName, s string, names []string) (int, error) {
+	for i, name := range names {
+		if name == s {
+			return i, nil
+		}
+	}
+	var v int
+	if _, err := fmt.Sscanf(s, typeName+"(%d)", &v); err == nil {
+		return v, nil
+	}
+	if v, err := strconv.Atoi(s); err == nil {
+		return v, nil
+	}
+	return 0, fmt.Errorf("%s: cannot parse %q", typeName, s)
+}
+
+func scanEnum(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return int(v), nil
+	case []byte:
+		return strconv.Atoi(string(v))
+	case string:
+		return strconv.Atoi(v)
+	default:
+		return 0, fmt.Errorf("unsupported type: %T", value)
+	}
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type IDFormat string
+
+const (
+	IDFormatTxLog      IDFormat = "tx-log"
+	IDFormatChainTxLog IDFormat = "chain-tx-log"
+)
+
+func FormatEventID(chainID int64, txHash string, logIndex uint) string {
+	if CFG.IDFormat == IDFormatChainTxLog {
+		return fmt.Sprintf("%d-%s-%d", chainID, txHash, logIndex)
+	}
+	return txHash + "-" + strconv.FormatUint(uint64(logIndex), 10)
+}
+
+func EventTables() []interface{} {
+	var tables []interface{}
+	for _, name := range KnownContractNames {
+		tables = append(tables, ContractTables[name]...)
+	}
+	return tables
+}
+
+func MigrateEventIDs(db *gorm.DB, target IDFormat, networks []NetworkEndpoint) (map[string]int64, error) {
+	if target != IDFormatChainTxLog && target != IDFormatTxLog {
+		return nil, fmt.Errorf("unknown id format: %s", target)
+	}
+	counts := make(map[string]int64)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, network := range networks {
+			prefix := fmt.Sprintf("%d-", network.ChainID)
+			// With a single network every row belongs to it, including rows written before the network column existed.
+			scope := ""
+			var scopeVars []interface{}
+			if len(networks) > 1 {
+				scope, scopeVars = " AND network = ?", []interface{}{network.Name}
+			}
+
+			for _, model := range append(EventTables(), &RawEvent{}) {
+				table := GetTableName(tx, model)
+
+				var result *gorm.DB
+				switch target {
+				case IDFormatChainTxLog:
+					result = tx.Exec(fmt.Sprintf("UPDATE %s SET id = %s WHERE id LIKE ?%s",
+						table, concatSQL(tx, "?", "id"), scope), append([]interface{}{prefix, "0x%"}, scopeVars...)...)
+				case IDFormatTxLog:
+					result = tx.Exec(fmt.Sprintf("UPDATE %s SET id = SUBSTR(id, ?) WHERE id LIKE ?%s", table, scope),
+						append([]interface{}{len(prefix) + 1, prefix + "0x%"}, scopeVars...)...)
+				}
+
+				if result.Error != nil {
+					return fmt.Errorf("failed to rewrite ids in %s: %w", table, result.Error)
+				}
+				counts[table] += result.RowsAffected
+			}
+		}
+		return migratePayloadIDs(tx, target, networks, counts)
+	})
+
+	return counts, err
+}
+
+// migratePayloadIDs rewrites the ids of entities kept as JSON, so queued and dead-lettered rows replay under the new ids.
+func migratePayloadIDs(tx *gorm.DB, target IDFormat, networks []NetworkEndpoint, counts map[string]int64) error {
+	var queued []QueuedEntity
+	if err := tx.Find(&queued).Error; err != nil {
+		return fmt.Errorf("failed to read queued entities: %w", err)
+	}
+	for _, row := range queued {
+		payload, _, ok, err := rewritePayloadID(row.Payload, target, networks)
+		if err != nil {
+			return fmt.Errorf("queued entity %d: %w", row.ID, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := tx.Model(&row).Update("payload", payload).Error; err != nil {
+			return fmt.Errorf("failed to rewrite queued entity %d: %w", row.ID, err)
+		}
+		counts[GetTableName(tx, &QueuedEntity{})]++
+	}
+
+	var letters []DeadLetter
+	if err := tx.Find(&letters).Error; err != nil {
+		return fmt.Errorf("failed to read dead letters: %w", err)
+	}
+	for _, row := range letters {
+		payload, id, ok, err := rewritePayloadID(row.Payload, target, networks)
+		if err != nil {
+			return fmt.Errorf("dead letter %d: %w", row.ID, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := tx.Model(&row).Updates(map[string]interface{}{"payload": payload, "entity_id": id}).Error; err != nil {
+			return fmt.Errorf("failed to rewrite dead letter %d: %w", row.ID, err)
+		}
+		counts[GetTableName(tx, &DeadLetter{})]++
+	}
+	return nil
+}
+
+func rewritePayloadID(payload string, target IDFormat, networks []NetworkEndpoint) (string, string, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(payload), &fields); err != nil {
+		return "", "", false, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	var id, network string
+	if raw, ok := fields["ID"]; !ok || json.Unmarshal(raw, &id) != nil {
+		return "", "", false, nil
+	}
+	if raw, ok := fields["Network"]; ok {
+		_ = json.Unmarshal(raw, &network)
+	}
+
+	chainID, ok := payloadChainID(network, networks)
+	if !ok {
+		return "", "", false, nil
+	}
+	newID, ok := rewriteEventID(id, target, chainID)
+	if !ok {
+		return "", "", false, nil
+	}
+
+	encoded, err := json.Marshal(newID)
+	if err != nil {
+		return "", "", false, err
+	}
+	fields["ID"] = encoded
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	return string(rewritten), newID, true, nil
+}
+
+func payloadChainID(network string, networks []NetworkEndpoint) (int64, bool) {
+	// Payloads written before the network column existed belong to the default network, as AssignDefaultNetwork does for rows.
+	if network == "" || len(networks) == 1 {
+		return networks[0].ChainID, true
+	}
+	for _, n := range networks {
+		if n.Name == network {
+			return n.ChainID, true
+		}
+	}
+	return 0, false
+}
+
+func rewriteEventID(id string, target IDFormat, chainID int64) (string, bool) {
+	prefix := fmt.Sprintf("%d-", chainID)
+	switch target {
+	case IDFormatChainTxLog:
+		if strings.HasPrefix(id, "0x") {
+			return prefix + id, true
+		}
+	case IDFormatTxLog:
+		if strings.HasPrefix(id, prefix+"0x") {
+			return id[len(prefix):], true
+		}
+	}
+	return id, false
+}
+
+func concatSQL(db *gorm.DB, left, right string) string {
+	if db.Dialector.Name() == "mysql" {
+		return fmt.Sprintf("CONCAT(%s, %s)", left, right)
+	}
+	return fmt.Sprintf("%s || %s", left, right)
+}
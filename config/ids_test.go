@@ -0,0 +1,97 @@
+package config
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestMigrateEventIDsUsesEachNetworksChain(t *testing.T) {
+	saved := CFG
+	defer func() { CFG = saved }()
+
+	db := openTestDB(t)
+	if err := db.AutoMigrate(append(EventTables(), &RawEvent{}, &QueuedEntity{}, &DeadLetter{})...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, row := range []Paused{
+		{ID: "0xaa-0", Network: "testnet"},
+		{ID: "0xbb-1", Network: "mainnet"},
+	} {
+		row.BlockNumber, row.BlockTimestamp = BigInt{Int: big.NewInt(1)}, BigInt{Int: big.NewInt(1)}
+		if err := db.Create(&row).Error; err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+
+	networks := []NetworkEndpoint{{Name: "testnet", ChainID: 296}, {Name: "mainnet", ChainID: 295}}
+	if _, err := MigrateEventIDs(db, IDFormatChainTxLog, networks); err != nil {
+		t.Fatalf("migrate to chain ids: %v", err)
+	}
+
+	CFG.IDFormat = IDFormatChainTxLog
+	for _, want := range []struct {
+		network string
+		id      string
+	}{
+		{"testnet", FormatEventID(296, "0xaa", 0)},
+		{"mainnet", FormatEventID(295, "0xbb", 1)},
+	} {
+		var row Paused
+		if err := db.Where("network = ?", want.network).First(&row).Error; err != nil {
+			t.Fatalf("read %s: %v", want.network, err)
+		}
+		if row.ID != want.id {
+			t.Errorf("%s id = %s, want %s", want.network, row.ID, want.id)
+		}
+	}
+
+	if _, err := MigrateEventIDs(db, IDFormatTxLog, networks); err != nil {
+		t.Fatalf("migrate back: %v", err)
+	}
+	var ids []string
+	if err := db.Model(&Paused{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		t.Fatalf("read ids: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != "0xaa-0" || ids[1] != "0xbb-1" {
+		t.Errorf("ids after migrating back = %v", ids)
+	}
+}
+
+func TestMigrateEventIDsRewritesRawEventsAndPayloads(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(append(EventTables(), &RawEvent{}, &QueuedEntity{}, &DeadLetter{})...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	one := BigInt{Int: big.NewInt(1)}
+	rows := []interface{}{
+		&RawEvent{ID: "0xaa-0", ContractAddress: "0x01", Topics: "[]", Data: "0x", BlockNumber: one, BlockTimestamp: one, TransactionHash: "0xaa", Network: "mainnet"},
+		&QueuedEntity{ContractAddress: "0x01", EventType: "Paused", Payload: `{"ID":"0xbb-1","Network":"mainnet"}`},
+		&DeadLetter{ContractAddress: "0x01", EventType: "Paused", EntityID: "0xcc-2", Payload: `{"ID":"0xcc-2","Network":""}`, Error: "rejected"},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+
+	networks := []NetworkEndpoint{{Name: "mainnet", ChainID: 295}, {Name: "testnet", ChainID: 296}}
+	if _, err := MigrateEventIDs(db, IDFormatChainTxLog, networks); err != nil {
+		t.Fatalf("migrate to chain ids: %v", err)
+	}
+
+	var raw RawEvent
+	var queued QueuedEntity
+	var letter DeadLetter
+	db.First(&raw)
+	db.First(&queued)
+	db.First(&letter)
+	if raw.ID != "295-0xaa-0" {
+		t.Errorf("raw event id = %s", raw.ID)
+	}
+	if queued.Payload != `{"ID":"295-0xbb-1","Network":"mainnet"}` {
+		t.Errorf("queued payload = %s", queued.Payload)
+	}
+	if letter.EntityID != "295-0xcc-2" || letter.Payload != `{"ID":"295-0xcc-2","Network":""}` {
+		t.Errorf("dead letter id = %s, payload = %s", letter.EntityID, letter.Payload)
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	marketSearchLimit   = 50
+	marketSearchDialect = "english"
+)
+
+func EnsureMarketSearchIndex(db *gorm.DB) error {
+	table := GetTableName(db, &MarketCreated{})
+	// Index names share one namespace per schema, so they follow the (possibly prefixed) table name.
+	marketSearchIndex := "idx_" + table + "_question_fts"
+
+	switch db.Dialector.Name() {
+	case "postgres":
+		return db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (to_tsvector('%s', question))",
+			marketSearchIndex, table, marketSearchDialect)).Error
+	case "mysql":
+		if db.Migrator().HasIndex(&MarketCreated{}, marketSearchIndex) {
+			return nil
+		}
+		return db.Exec(fmt.Sprintf("ALTER TABLE %s ADD FULLTEXT INDEX %s (question)", table, marketSearchIndex)).Error
+	}
+	return nil
+}
+
+func SearchMarkets(db *gorm.DB, query string) ([]MarketCreated, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("empty search query")
+	}
+
+	q := db.Model(&MarketCreated{})
+	if CFG.Environment != "" {
+		q = q.Where("environment = ?", CFG.Environment)
+	}
+
+	switch db.Dialector.Name() {
+	case "postgres":
+		tsquery := fmt.Sprintf("websearch_to_tsquery('%s', ?)", marketSearchDialect)
+		tsvector := fmt.Sprintf("to_tsvector('%s', question)", marketSearchDialect)
+		q = q.Where(fmt.Sprintf("%s @@ %s", tsvector, tsquery), query).
+			Order(gorm.Expr(fmt.Sprintf("ts_rank(%s, %s) DESC", tsvector, tsquery), query))
+	case "mysql":
+		q = q.Where("MATCH(question) AGAINST (? IN NATURAL LANGUAGE MODE)", query).
+			Order(gorm.Expr("MATCH(question) AGAINST (? IN NATURAL LANGUAGE MODE) DESC", query))
+	default:
+		// SQLite has no built-in ranking without an FTS5 table, so match every word and list newest first.
+		for _, word := range strings.Fields(strings.ToLower(query)) {
+			q = q.Where("LOWER(question) LIKE ?", "%"+word+"%")
+		}
+		q = q.Order("block_number DESC")
+	}
+
+	var markets []MarketCreated
+	if err := q.Limit(marketSearchLimit).Find(&markets).Error; err != nil {
+		return nil, fmt.Errorf("failed to search markets: %w", err)
+	}
+	return markets, nil
+}
@@ -0,0 +1,129 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+const abiFetchTimeout = 30 * time.Second
+
+func ParseABISources(value string) (map[string]string, error) {
+	sources := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		name, source, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || name == "" || source == "" {
+			return nil, fmt.Errorf("invalid abi source %q, expected Name=path", part)
+		}
+		sources[name] = source
+	}
+	return sources, nil
+}
+
+func VerifyABIs(w io.Writer, sources map[string]string) (bool, error) {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	matched := true
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTRACT\tEVENT\tSTATUS\tPARSER\tABI")
+
+	for _, name := range names {
+		if _, ok := eventSignatures[name]; !ok {
+			return false, fmt.Errorf("no parsers registered for contract %s", name)
+		}
+		data, err := readABI(sources[name])
+		if err != nil {
+			return false, fmt.Errorf("failed to read ABI for %s: %w", name, err)
+		}
+		contractABI, err := parseABI(data)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse ABI for %s: %w", name, err)
+		}
+		matched = verifyABI(tw, name, contractABI) && matched
+	}
+
+	return matched, tw.Flush()
+}
+
+func verifyABI(w io.Writer, contractName string, contractABI abi.ABI) bool {
+	events := make([]string, 0, len(eventSignatures[contractName]))
+	for event := range eventSignatures[contractName] {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	matched := true
+	for _, event := range events {
+		signature := eventSignatures[contractName][event]
+		abiEvent, ok := contractABI.Events[event]
+		switch {
+		case !ok:
+			matched = false
+			fmt.Fprintf(w, "%s\t%s\tmissing from ABI\t%s\t-\n", contractName, event, signature.Hex())
+		case abiEvent.ID != signature:
+			matched = false
+			fmt.Fprintf(w, "%s\t%s\tMISMATCH\t%s\t%s %s\n", contractName, event, signature.Hex(), abiEvent.ID.Hex(), abiEvent.Sig)
+		default:
+			fmt.Fprintf(w, "%s\t%s\tok\t%s\t%s\n", contractName, event, signature.Hex(), abiEvent.Sig)
+		}
+	}
+
+	var unparsed []string
+	for event := range contractABI.Events {
+		if _, ok := eventSignatures[contractName][event]; !ok {
+			unparsed = append(unparsed, event)
+		}
+	}
+	sort.Strings(unparsed)
+	for _, event := range unparsed {
+		abiEvent := contractABI.Events[event]
+		fmt.Fprintf(w, "%s\t%s\tno parser\t-\t%s %s\n", contractName, event, abiEvent.ID.Hex(), abiEvent.Sig)
+	}
+
+	return matched
+}
+
+func parseABI(data []byte) (abi.ABI, error) {
+	// Build artifacts (Hardhat, Foundry) wrap the ABI in an object.
+	var artifact struct {
+		ABI json.RawMessage `json:"abi"`
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &artifact); err != nil {
+			return abi.ABI{}, err
+		}
+		data = artifact.ABI
+	}
+	return abi.JSON(bytes.NewReader(data))
+}
+
+func readABI(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	client := http.Client{Timeout: abiFetchTimeout}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
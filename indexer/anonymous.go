@@ -0,0 +1,56 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/evaafi/go-indexer/config"
+)
+
+var ErrAnonymousEvent = errors.New("unrecognized anonymous event")
+
+// Anonymous events have no signature in topic0, so the only thing to match on is their shape.
+type anonymousLayout struct {
+	name       string
+	topics     int
+	dataLength int
+	parse      ParseFunc
+}
+
+var anonymousParsers = make(map[string][]anonymousLayout)
+
+func RegisterAnonymousParser(contractName, eventName string, topics, dataLength int, fn ParseFunc) {
+	anonymousParsers[contractName] = append(anonymousParsers[contractName], anonymousLayout{
+		name:       eventName,
+		topics:     topics,
+		dataLength: dataLength,
+		parse:      fn,
+	})
+}
+
+func hasAnonymousParsers(contractName string) bool {
+	return len(anonymousParsers[contractName]) > 0
+}
+
+func lookupAnonymousParser(contract config.Contract, log types.Log) (ParseFunc, error) {
+	var matches []anonymousLayout
+	for _, layout := range anonymousParsers[contract.Name] {
+		if layout.topics == len(log.Topics) && layout.dataLength == len(log.Data) {
+			matches = append(matches, layout)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %d topics and %d data bytes for contract %s", ErrAnonymousEvent, len(log.Topics), len(log.Data), contract.Address)
+	case 1:
+		return matches[0].parse, nil
+	}
+
+	names := make([]string, len(matches))
+	for i, layout := range matches {
+		names[i] = layout.name
+	}
+	return nil, fmt.Errorf("%w: %d topics and %d data bytes match %v for contract %s", ErrAnonymousEvent, len(log.Topics), len(log.Data), names, contract.Address)
+}
@@ -0,0 +1,189 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ContractSyncStatus struct {
+	Network        string `json:"network,omitempty"`
+	Contract       string `json:"contract"`
+	Address        string `json:"address"`
+	LastBlock      int64  `json:"lastBlock"`
+	LastBlockTime  string `json:"lastBlockTime,omitempty"`
+	FinalizedBlock int64  `json:"finalizedBlock"`
+}
+
+func GetSyncStatuses(db *gorm.DB) ([]ContractSyncStatus, error) {
+	var states []config.SyncState
+	if err := db.Order("network, contract_name").Find(&states).Error; err != nil {
+		return nil, err
+	}
+
+	statuses := make([]ContractSyncStatus, 0, len(states))
+	for _, state := range states {
+		status := ContractSyncStatus{
+			Network:        state.Network,
+			Contract:       state.ContractName,
+			Address:        state.ContractAddress,
+			LastBlock:      state.LastBlock,
+			FinalizedBlock: state.FinalizedBlock,
+		}
+		if state.LastBlockTimestamp > 0 {
+			status.LastBlockTime = time.Unix(state.LastBlockTimestamp, 0).UTC().Format(time.RFC3339)
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func NewAPIHandler(db *gorm.DB, feed *EventFeed) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	if feed != nil {
+		mux.Handle("/events", feed)
+	}
+
+	mux.HandleFunc("/bets", func(w http.ResponseWriter, r *http.Request) {
+		page, err := GetBets(db.WithContext(r.Context()), r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, page)
+	})
+
+	mux.HandleFunc("/markets/search", func(w http.ResponseWriter, r *http.Request) {
+		markets, err := config.SearchMarkets(db.WithContext(r.Context()), r.URL.Query().Get("q"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, markets)
+	})
+
+	mux.HandleFunc("/markets/vault-rebalances", func(w http.ResponseWriter, r *http.Request) {
+		activity, err := GetMarketVaultActivity(db.WithContext(r.Context()), r.URL.Query().Get("market"))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, activity)
+	})
+
+	mux.HandleFunc("/users/timeline", func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		fromBlock, _ := strconv.ParseUint(params.Get("fromBlock"), 10, 64)
+		toBlock, _ := strconv.ParseUint(params.Get("toBlock"), 10, 64)
+		timeline, err := GetUserTimeline(db.WithContext(r.Context()), params.Get("address"), fromBlock, toBlock)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, timeline)
+	})
+
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, OpenAPISpec())
+	})
+
+	mux.HandleFunc("/contract-status", func(w http.ResponseWriter, r *http.Request) {
+		statuses, err := GetContractStatuses(db.WithContext(r.Context()))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, statuses)
+	})
+
+	mux.HandleFunc("/sync-status", func(w http.ResponseWriter, r *http.Request) {
+		statuses, err := GetSyncStatuses(db.WithContext(r.Context()))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, statuses)
+	})
+
+	return mux
+}
+
+type FormattedBet struct {
+	config.BetPlaced
+	AmountFormatted string `json:"amountFormatted,omitempty"`
+	SharesFormatted string `json:"sharesFormatted,omitempty"`
+}
+
+func GetBets(db *gorm.DB, params url.Values) (Page[FormattedBet], error) {
+	var result Page[FormattedBet]
+
+	query := db.Model(&config.BetPlaced{})
+	if market := params.Get("market"); market != "" {
+		var marketID config.BigInt
+		if err := marketID.UnmarshalText([]byte(market)); err != nil {
+			return result, fmt.Errorf("invalid market: %w", err)
+		}
+		query = query.Where("market_id = ?", marketID)
+	}
+	if user := params.Get("user"); user != "" {
+		query = query.Where(clause.Eq{Column: clause.Column{Name: "user"}, Value: strings.ToLower(user)})
+	}
+	if config.CFG.Environment != "" {
+		query = query.Where("environment = ?", config.CFG.Environment)
+	}
+
+	limit, _ := strconv.Atoi(params.Get("limit"))
+	page, err := Paginate[config.BetPlaced](query, params.Get("cursor"), limit)
+	if err != nil {
+		return result, err
+	}
+
+	decimals := make(map[string]int)
+	result.NextCursor = page.NextCursor
+	result.Items = make([]FormattedBet, 0, len(page.Items))
+	for _, bet := range page.Items {
+		item := FormattedBet{BetPlaced: bet}
+		marketID := bet.MarketID.String()
+		d, ok := decimals[marketID]
+		if !ok {
+			d = marketTokenDecimals(db, bet.MarketID)
+			decimals[marketID] = d
+		}
+		if d >= 0 {
+			item.AmountFormatted = bet.Amount.FormatUnits(d)
+			item.SharesFormatted = bet.Shares.FormatUnits(d)
+		}
+		result.Items = append(result.Items, item)
+	}
+
+	return result, nil
+}
+
+func marketTokenDecimals(db *gorm.DB, marketID config.BigInt) int {
+	var markets []config.MarketCreated
+	if err := db.Where("market_id = ?", marketID).Limit(1).Find(&markets).Error; err != nil || len(markets) == 0 {
+		return -1
+	}
+	market := markets[0]
+	d, ok := config.CFG.TokenDecimalsFor(market.TokenAddress)
+	if !ok {
+		return -1
+	}
+	return d
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,92 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+)
+
+type insertBuffer struct {
+	contract config.Contract
+	entities []interface{}
+	since    time.Time
+}
+
+var (
+	bufferMu sync.Mutex
+	buffers  = make(map[string]*insertBuffer)
+)
+
+func bufferingEnabled() bool {
+	return config.CFG.InsertBufferSize > 0 && !config.CFG.DryRun
+}
+
+func bufferEntities(contract config.Contract, entities []interface{}) {
+	bufferMu.Lock()
+	defer bufferMu.Unlock()
+
+	b, ok := buffers[contract.Address]
+	if !ok {
+		b = &insertBuffer{contract: contract, since: time.Now()}
+		buffers[contract.Address] = b
+	}
+	b.entities = append(b.entities, entities...)
+}
+
+func bufferedCount(contract config.Contract) int {
+	bufferMu.Lock()
+	defer bufferMu.Unlock()
+
+	if b, ok := buffers[contract.Address]; ok {
+		return len(b.entities)
+	}
+	return 0
+}
+
+func bufferDue(contract config.Contract) bool {
+	bufferMu.Lock()
+	defer bufferMu.Unlock()
+
+	b, ok := buffers[contract.Address]
+	if !ok || len(b.entities) == 0 {
+		return false
+	}
+	if len(b.entities) >= config.CFG.InsertBufferSize {
+		return true
+	}
+	return config.CFG.InsertBufferInterval > 0 && time.Since(b.since) >= config.CFG.InsertBufferInterval
+}
+
+func discardBuffer(contract config.Contract) {
+	bufferMu.Lock()
+	defer bufferMu.Unlock()
+	delete(buffers, contract.Address)
+}
+
+func flushBuffer(ctx context.Context, sink EventSink, contract config.Contract) error {
+	bufferMu.Lock()
+	b, ok := buffers[contract.Address]
+	bufferMu.Unlock()
+	if !ok || len(b.entities) == 0 {
+		return nil
+	}
+
+	enqueue(contract, b.entities)
+	if err := sink.Store(ctx, contract, b.entities); err != nil {
+		// The entities stay buffered for the next flush, SaveQueue persists them on shutdown.
+		dequeue(contract)
+		return err
+	}
+	dequeue(contract)
+
+	bufferMu.Lock()
+	delete(buffers, contract.Address)
+	bufferMu.Unlock()
+
+	recordThroughput(contract, 0, uint64(len(b.entities)))
+	fmt.Printf("[%s] Flushed %d buffered events\n", contract.Name, len(b.entities))
+	return nil
+}
@@ -0,0 +1,60 @@
+package indexer
+
+import (
+	"container/list"
+	"sync"
+)
+
+type timestampCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[uint64]*list.Element
+	order   *list.List
+}
+
+type timestampEntry struct {
+	blockNumber uint64
+	timestamp   uint64
+}
+
+func newTimestampCache(size int) *timestampCache {
+	return &timestampCache{
+		size:    size,
+		entries: make(map[uint64]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *timestampCache) Get(blockNumber uint64) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[blockNumber]
+	if !ok {
+		return 0, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*timestampEntry).timestamp, true
+}
+
+func (c *timestampCache) Add(blockNumber, timestamp uint64) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[blockNumber]; ok {
+		el.Value.(*timestampEntry).timestamp = timestamp
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[blockNumber] = c.order.PushFront(&timestampEntry{blockNumber: blockNumber, timestamp: timestamp})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*timestampEntry).blockNumber)
+	}
+}
@@ -0,0 +1,87 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/evaafi/go-indexer/config"
+)
+
+var CaughtUp = make(chan struct{})
+
+var catchUp = struct {
+	sync.Mutex
+	pending    map[string]bool
+	registered bool
+	started    bool
+	closed     bool
+}{pending: make(map[string]bool)}
+
+func expectCatchUp(contract config.Contract) {
+	catchUp.Lock()
+	catchUp.pending[contract.Address] = true
+	catchUp.registered = true
+	catchUp.Unlock()
+}
+
+// catchUpStarted is called once every contract that will run has been registered, until then
+// a contract catching up early can't close CaughtUp for the ones not started yet.
+func catchUpStarted() {
+	catchUp.Lock()
+	catchUp.started = true
+	all := allCaughtUp()
+	catchUp.Unlock()
+
+	if all {
+		fmt.Println("All contracts caught up with chain head")
+		close(CaughtUp)
+	}
+}
+
+// dropCatchUp stops waiting for a contract that halted or gave up, so the others can still close CaughtUp.
+func dropCatchUp(contract config.Contract) {
+	catchUp.Lock()
+	if !catchUp.pending[contract.Address] {
+		catchUp.Unlock()
+		return
+	}
+	delete(catchUp.pending, contract.Address)
+	all := allCaughtUp()
+	catchUp.Unlock()
+
+	if all {
+		fmt.Println("All running contracts caught up with chain head")
+		close(CaughtUp)
+	}
+}
+
+func markCaughtUp(ctx context.Context, sink EventSink, contract config.Contract) {
+	catchUp.Lock()
+	if !catchUp.pending[contract.Address] {
+		catchUp.Unlock()
+		return
+	}
+	delete(catchUp.pending, contract.Address)
+	all := allCaughtUp()
+	catchUp.Unlock()
+
+	fmt.Printf("[%s] Caught up with chain head\n", contract.Name)
+	if listener, ok := sink.(CatchUpListener); ok {
+		listener.CaughtUp(ctx, contract)
+	}
+
+	if all {
+		fmt.Println("All contracts caught up with chain head")
+		close(CaughtUp)
+	}
+}
+
+// allCaughtUp reports whether CaughtUp should close now, marking it closed. The caller holds the lock.
+func allCaughtUp() bool {
+	if !catchUp.started || !catchUp.registered || catchUp.closed || len(catchUp.pending) > 0 {
+		return false
+	}
+	catchUp.closed = true
+	return true
+}
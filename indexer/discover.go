@@ -0,0 +1,96 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+)
+
+func DiscoverStartBlocks(ctx context.Context, cfg config.Config, db *gorm.DB) {
+	clients := make(map[string]*RPCClient)
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+
+	for _, network := range cfg.IndexedNetworks() {
+		for _, contract := range config.NetworkContracts[network.Name] {
+			if contract.StartBlock != 0 {
+				continue
+			}
+
+			var state config.SyncState
+			err := db.Where("contract_address = ?", contract.Address).First(&state).Error
+			if err == nil {
+				// The row already tracks progress, reuse the block discovered when it was created, if any.
+				if state.StartBlock > 0 {
+					config.SetStartBlock(contract.Address, state.StartBlock)
+				}
+				continue
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				fmt.Printf("Warning: [%s] failed to read sync state for %s: %v\n", network.Name, contract.Name, err)
+				continue
+			}
+
+			endpoint := network.RPCEndpoint
+			if contract.RPCEndpoint != "" {
+				endpoint = contract.RPCEndpoint
+			}
+			client, err := selfTestClient(ctx, cfg, clients, endpoint)
+			if err != nil {
+				fmt.Printf("Warning: [%s] cannot discover start block for %s: %v\n", network.Name, contract.Name, err)
+				continue
+			}
+
+			created, err := findCreationBlock(ctx, client, contract.Address)
+			if err != nil {
+				fmt.Printf("Warning: [%s] cannot discover start block for %s, starting from block 0: %v\n", network.Name, contract.Name, err)
+				continue
+			}
+
+			// Indexing resumes after the stored block, so start one block before the contract was created.
+			start := int64(created) - 1
+			if start < 0 {
+				start = 0
+			}
+			config.SetStartBlock(contract.Address, start)
+			fmt.Printf("[%s] Discovered %s was created at block %d\n", network.Name, contract.Name, created)
+		}
+	}
+}
+
+func findCreationBlock(ctx context.Context, client *RPCClient, address string) (uint64, error) {
+	latest, err := client.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	hasCode, err := client.HasCode(ctx, address)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get code: %w", err)
+	}
+	if !hasCode {
+		return 0, fmt.Errorf("no contract code at %s", address)
+	}
+
+	// Code only appears once, so the first block with code can be found by bisection; this needs an archive node.
+	lo, hi := uint64(0), latest
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		code, err := client.GetCodeAtBlock(ctx, address, mid)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get code at block %d: %w", mid, err)
+		}
+		if len(code) > 0 {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
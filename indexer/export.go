@@ -0,0 +1,80 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+)
+
+type ExportOptions struct {
+	Table     string
+	FromBlock uint64
+	ToBlock   uint64
+	MarketID  string
+}
+
+func ExportEvents(ctx context.Context, db *gorm.DB, w io.Writer, opts ExportOptions) (int64, error) {
+	model, ok := exportModel(db, opts.Table)
+	if !ok {
+		return 0, fmt.Errorf("unknown event table %s", opts.Table)
+	}
+	modelType := reflect.TypeOf(model).Elem()
+
+	query := db.WithContext(ctx).Model(model)
+	if opts.FromBlock > 0 {
+		query = query.Where("block_number >= ?", opts.FromBlock)
+	}
+	if opts.ToBlock > 0 {
+		query = query.Where("block_number <= ?", opts.ToBlock)
+	}
+	if opts.MarketID != "" {
+		if _, ok := modelType.FieldByName("MarketID"); !ok {
+			return 0, fmt.Errorf("table %s has no market_id column", opts.Table)
+		}
+		var marketID config.BigInt
+		if err := marketID.UnmarshalText([]byte(opts.MarketID)); err != nil {
+			return 0, fmt.Errorf("invalid market id: %w", err)
+		}
+		query = query.Where("market_id = ?", marketID)
+	}
+	if config.CFG.Environment != "" {
+		query = query.Where("environment = ?", config.CFG.Environment)
+	}
+
+	rows, err := query.Order("block_number, log_index").Rows()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query %s: %w", opts.Table, err)
+	}
+	defer rows.Close()
+
+	encoder := json.NewEncoder(w)
+	var count int64
+	for rows.Next() {
+		row := reflect.New(modelType).Interface()
+		if err := db.ScanRows(rows, row); err != nil {
+			return count, fmt.Errorf("failed to scan %s row: %w", opts.Table, err)
+		}
+		if err := encoder.Encode(row); err != nil {
+			return count, fmt.Errorf("failed to write %s row: %w", opts.Table, err)
+		}
+		count++
+	}
+
+	return count, rows.Err()
+}
+
+func exportModel(db *gorm.DB, table string) (interface{}, bool) {
+	for _, model := range append(config.EventTables(), &config.RawEvent{}) {
+		// Accept the unprefixed name too, the prefix is a deployment detail.
+		name := config.GetTableName(db, model)
+		if name == table || name == config.CFG.TablePrefix+table {
+			return model, true
+		}
+	}
+	return nil, false
+}
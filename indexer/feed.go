@@ -0,0 +1,159 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/evaafi/go-indexer/config"
+)
+
+const feedBufferSize = 256
+
+type FeedFilter struct {
+	EventType string
+	MarketID  string
+	User      string
+}
+
+type CatchUpEvent struct {
+	Contract string `json:"contract"`
+	Address  string `json:"address"`
+	Network  string `json:"network,omitempty"`
+}
+
+type feedEvent struct {
+	contract  string
+	eventType string
+	entity    interface{}
+}
+
+type feedSubscriber struct {
+	filter FeedFilter
+	events chan feedEvent
+}
+
+type EventFeed struct {
+	mu          sync.Mutex
+	subscribers map[*feedSubscriber]struct{}
+}
+
+func NewEventFeed() *EventFeed {
+	return &EventFeed{subscribers: make(map[*feedSubscriber]struct{})}
+}
+
+func (f *EventFeed) Store(ctx context.Context, contract config.Contract, entities []interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, entity := range entities {
+		event := feedEvent{contract: contract.Name, eventType: eventTypeName(entity), entity: entity}
+		for sub := range f.subscribers {
+			if !sub.filter.matches(event) {
+				continue
+			}
+			select {
+			case sub.events <- event:
+			default:
+				fmt.Printf("Warning: event feed subscriber is too slow, dropping %s\n", event.eventType)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *EventFeed) CaughtUp(ctx context.Context, contract config.Contract) {
+	f.Store(ctx, contract, []interface{}{&CatchUpEvent{Contract: contract.Name, Address: contract.Address, Network: contract.Network}})
+}
+
+func (f *EventFeed) subscribe(filter FeedFilter) *feedSubscriber {
+	sub := &feedSubscriber{filter: filter, events: make(chan feedEvent, feedBufferSize)}
+	f.mu.Lock()
+	f.subscribers[sub] = struct{}{}
+	f.mu.Unlock()
+	return sub
+}
+
+func (f *EventFeed) unsubscribe(sub *feedSubscriber) {
+	f.mu.Lock()
+	delete(f.subscribers, sub)
+	f.mu.Unlock()
+}
+
+func (f *EventFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	sub := f.subscribe(FeedFilter{
+		EventType: query.Get("type"),
+		MarketID:  query.Get("market"),
+		User:      query.Get("user"),
+	})
+	defer f.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-sub.events:
+			data, err := json.Marshal(event.entity)
+			if err != nil {
+				fmt.Printf("Warning: failed to encode %s for event feed: %v\n", event.eventType, err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.eventType, data)
+			flusher.Flush()
+		}
+	}
+}
+
+func (filter FeedFilter) matches(event feedEvent) bool {
+	if filter.EventType != "" && filter.EventType != event.eventType {
+		return false
+	}
+
+	if filter.MarketID == "" && filter.User == "" {
+		return true
+	}
+
+	v := reflect.ValueOf(event.entity)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+
+	if filter.MarketID != "" {
+		field := v.FieldByName("MarketID")
+		if !field.IsValid() {
+			return false
+		}
+		marketID, ok := field.Interface().(config.BigInt)
+		if !ok || marketID.String() != filter.MarketID {
+			return false
+		}
+	}
+	if filter.User != "" {
+		user := v.FieldByName("User")
+		if !user.IsValid() || user.Kind() != reflect.String || !strings.EqualFold(user.String(), filter.User) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,149 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func recordScannedRange(db *gorm.DB, contract config.Contract, fromBlock, toBlock uint64) error {
+	if !config.CFG.TrackScannedRanges || toBlock < fromBlock {
+		return nil
+	}
+
+	// Extend the range that ends right before this one so consecutive ranges collapse into a single row.
+	if fromBlock > 0 {
+		res := db.Model(&config.ScannedRange{}).
+			Where("contract_address = ? AND to_block = ?", contract.Address, int64(fromBlock)-1).
+			Updates(map[string]interface{}{"to_block": int64(toBlock), "scanned_at": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			return nil
+		}
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "contract_address"}, {Name: "from_block"}},
+		DoUpdates: clause.AssignmentColumns([]string{"to_block", "scanned_at"}),
+	}).Create(&config.ScannedRange{
+		ContractAddress: contract.Address,
+		FromBlock:       int64(fromBlock),
+		ToBlock:         int64(toBlock),
+		ScannedAt:       time.Now(),
+	}).Error
+}
+
+func FindScanGaps(db *gorm.DB, contract config.Contract, fromBlock, toBlock uint64) ([]config.BlockRange, error) {
+	if toBlock < fromBlock {
+		return nil, nil
+	}
+
+	var ranges []config.ScannedRange
+	if err := db.Where("contract_address = ? AND to_block >= ? AND from_block <= ?", contract.Address, int64(fromBlock), int64(toBlock)).
+		Order("from_block").Find(&ranges).Error; err != nil {
+		return nil, fmt.Errorf("failed to load scanned ranges for %s: %w", contract.Name, err)
+	}
+
+	var gaps []config.BlockRange
+	cursor := fromBlock
+	for _, r := range ranges {
+		if uint64(r.FromBlock) > cursor {
+			gaps = append(gaps, config.BlockRange{FromBlock: cursor, ToBlock: min(uint64(r.FromBlock)-1, toBlock)})
+		}
+		if uint64(r.ToBlock)+1 > cursor {
+			cursor = uint64(r.ToBlock) + 1
+		}
+		if cursor > toBlock {
+			return gaps, nil
+		}
+	}
+	return append(gaps, config.BlockRange{FromBlock: cursor, ToBlock: toBlock}), nil
+}
+
+func FillScanGaps(ctx context.Context, cfg config.Config, db *gorm.DB, sink EventSink, w io.Writer) error {
+	if !cfg.TrackScannedRanges {
+		return fmt.Errorf("gap-fill requires trackScannedRanges to be enabled")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NETWORK\tCONTRACT\tGAPS\tBLOCKS")
+
+	for _, network := range cfg.IndexedNetworks() {
+		if err := fillNetworkGaps(ctx, cfg, db, sink, tw, network); err != nil {
+			tw.Flush()
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+func fillNetworkGaps(ctx context.Context, cfg config.Config, db *gorm.DB, sink EventSink, w io.Writer, network config.NetworkEndpoint) error {
+	rpcClient, err := NewRPCClient(network.RPCEndpoint, RPCOptionsFromConfig(cfg))
+	if err != nil {
+		return err
+	}
+	clients := map[string]*RPCClient{network.RPCEndpoint: rpcClient}
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+
+	for _, contract := range EnabledContracts(SupportedContracts(config.NetworkContracts[network.Name])) {
+		client, err := contractRPCClient(ctx, cfg, clients, contract, rpcClient)
+		if err != nil {
+			return fmt.Errorf("failed to create RPC client for %s: %w", contract.Name, err)
+		}
+
+		var state config.SyncState
+		if err := db.Where("contract_address = ?", contract.Address).First(&state).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return fmt.Errorf("failed to get sync state for %s: %w", contract.Name, err)
+		}
+
+		// The sync state starts at StartBlock, so the first block that is ever scanned is the one after it.
+		gaps, err := FindScanGaps(db, contract, uint64(contract.StartBlock)+1, uint64(state.LastBlock))
+		if err != nil {
+			return err
+		}
+
+		var blocks uint64
+		for _, gap := range gaps {
+			blocks += gap.ToBlock - gap.FromBlock + 1
+			if err := rescanGap(ctx, cfg, db, client, sink, contract, gap); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", network.Name, contract.Name, len(gaps), blocks)
+	}
+	return nil
+}
+
+func rescanGap(ctx context.Context, cfg config.Config, db *gorm.DB, rpcClient *RPCClient, sink EventSink, contract config.Contract, gap config.BlockRange) error {
+	for fromBlock := gap.FromBlock; fromBlock <= gap.ToBlock; {
+		toBlock := min(fromBlock+uint64(cfg.BlockBatchSize)-1, gap.ToBlock)
+
+		fmt.Printf("[%s] Rescanning gap blocks %d to %d\n", contract.Name, fromBlock, toBlock)
+		if err := processBlockRange(ctx, sink, rpcClient, contract, fromBlock, toBlock, false); err != nil {
+			return fmt.Errorf("failed to rescan blocks %d-%d for %s: %w", fromBlock, toBlock, contract.Name, err)
+		}
+		if !cfg.DryRun {
+			if err := recordScannedRange(db, contract, fromBlock, toBlock); err != nil {
+				return fmt.Errorf("failed to record scanned range for %s: %w", contract.Name, err)
+			}
+		}
+		fromBlock = toBlock + 1
+	}
+	return nil
+}
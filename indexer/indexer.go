@@ -2,10 +2,17 @@ package indexer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/evaafi/go-indexer/config"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -16,62 +23,340 @@ var (
 	WG       sync.WaitGroup
 )
 
-func RunIndexer(ctx context.Context, cfg config.Config) {
-	rpcClient, err := NewRPCClient(cfg.RPCEndpoint)
+func RunIndexer(ctx context.Context, cfg config.Config, db *gorm.DB, sink EventSink) {
+	if cfg.ParseFailureReportInterval > 0 {
+		go reportParseFailures(ctx, cfg.ParseFailureReportInterval)
+	}
+	if cfg.ThroughputReportInterval > 0 {
+		go reportThroughput(ctx, cfg.ThroughputReportInterval)
+	}
+
+	clients := make(map[string]*RPCClient)
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+
+	for _, network := range cfg.IndexedNetworks() {
+		rpcClient, err := NewRPCClient(network.RPCEndpoint, RPCOptionsFromConfig(cfg))
+		if err != nil {
+			fmt.Printf("Failed to create RPC client for network %s: %v\n", network.Name, err)
+			continue
+		}
+		clients[network.RPCEndpoint] = rpcClient
+		if err := configureTimestampProvider(ctx, cfg, rpcClient); err != nil {
+			fmt.Printf("Failed to configure block timestamps for network %s: %v\n", network.Name, err)
+			continue
+		}
+
+		if rpcClient.ProbeFinalizedTag(ctx) {
+			fmt.Printf("[%s] RPC endpoint supports the finalized block tag, using it for finality\n", network.Name)
+		} else {
+			fmt.Printf("[%s] RPC endpoint does not support the finalized block tag, using %d confirmations for finality\n", network.Name, cfg.Confirmations)
+		}
+
+		contracts := EnabledContracts(SupportedContracts(config.NetworkContracts[network.Name]))
+		warnUnknownEventStartBlocks(contracts)
+		warnInvalidDataLayouts(contracts)
+		checkLogHistory(ctx, cfg, db, rpcClient, network, contracts)
+
+		for _, contract := range contracts {
+			client, err := contractRPCClient(ctx, cfg, clients, contract, rpcClient)
+			if err != nil {
+				fmt.Printf("Failed to create RPC client for contract %s: %v\n", contract.Name, err)
+				continue
+			}
+
+			if cfg.SkipSelfTest {
+				warnMissingCode(ctx, client, network, contract)
+			}
+
+			if len(cfg.BackfillRanges) > 0 {
+				r, ok := cfg.BackfillRanges[contract.Name]
+				if !ok {
+					continue
+				}
+				WG.Add(1)
+				go backfillContract(ctx, cfg, db, client, sink, contract, r)
+				continue
+			}
+
+			expectCatchUp(contract)
+			WG.Add(1)
+			go indexContract(ctx, cfg, db, client, sink, contract)
+		}
+	}
+	catchUpStarted()
+
+	WG.Wait()
+}
+
+func contractRPCClient(ctx context.Context, cfg config.Config, clients map[string]*RPCClient, contract config.Contract, networkClient *RPCClient) (*RPCClient, error) {
+	if contract.RPCEndpoint == "" {
+		return networkClient, nil
+	}
+	if client, ok := clients[contract.RPCEndpoint]; ok {
+		return client, nil
+	}
+
+	client, err := NewRPCClient(contract.RPCEndpoint, RPCOptionsFromConfig(cfg))
 	if err != nil {
-		fmt.Printf("Failed to create RPC client: %v\n", err)
+		return nil, err
+	}
+	if client.ProbeFinalizedTag(ctx) {
+		fmt.Printf("[%s] Dedicated RPC endpoint supports the finalized block tag\n", contract.Name)
+	}
+	clients[contract.RPCEndpoint] = client
+	if err := configureTimestampProvider(ctx, cfg, client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func warnMissingCode(ctx context.Context, rpcClient *RPCClient, network config.NetworkEndpoint, contract config.Contract) {
+	hasCode, err := rpcClient.HasCode(ctx, contract.Address)
+	if err != nil {
+		fmt.Printf("Warning: [%s] could not check code for %s at %s: %v\n", network.Name, contract.Name, contract.Address, err)
+		return
+	}
+	if !hasCode {
+		fmt.Printf("Warning: [%s] no contract code at %s for %s, it will never emit events; check that the address belongs to this network\n", network.Name, contract.Address, contract.Name)
+	}
+}
+
+func checkLogHistory(ctx context.Context, cfg config.Config, db *gorm.DB, rpcClient *RPCClient, network config.NetworkEndpoint, contracts []config.Contract) {
+	var earliest config.Contract
+	earliestBlock := uint64(0)
+	for _, contract := range contracts {
+		from := uint64(contract.StartBlock)
+		if r, ok := cfg.BackfillRanges[contract.Name]; ok {
+			from = r.FromBlock
+		} else if len(cfg.BackfillRanges) > 0 {
+			continue
+		} else {
+			var state config.SyncState
+			if err := db.Where("contract_address = ?", contract.Address).Limit(1).Find(&state).Error; err == nil && state.LastBlock >= contract.StartBlock {
+				from = uint64(state.LastBlock) + 1
+			}
+		}
+		if earliest.Address == "" || from < earliestBlock {
+			earliest, earliestBlock = contract, from
+		}
+	}
+	if earliest.Address == "" {
 		return
 	}
-	defer rpcClient.Close()
 
-	for _, contract := range config.Contracts {
-		WG.Add(1)
-		go indexContract(ctx, cfg, rpcClient, contract)
+	err := rpcClient.ProbeLogHistory(ctx, earliest.Address, earliestBlock)
+	if err == nil {
+		return
 	}
+	if isPrunedHistoryError(err) {
+		fmt.Printf("Error: [%s] RPC endpoint cannot serve logs at block %d needed by %s: %v\n", network.Name, earliestBlock, earliest.Name, err)
+		fmt.Printf("Error: [%s] the node appears to have pruned this history, point rpcEndpoint at an archive node or move startBlock forward\n", network.Name)
+		return
+	}
+	fmt.Printf("Warning: [%s] could not probe log history at block %d: %v\n", network.Name, earliestBlock, err)
 }
 
-func indexContract(ctx context.Context, cfg config.Config, rpcClient *RPCClient, contract config.Contract) {
+func SupportedContracts(contracts []config.Contract) []config.Contract {
+	var supported []config.Contract
+	for _, contract := range contracts {
+		if !HasParser(contract.Name) {
+			fmt.Printf("Warning: no parser registered for contract %s (%s), skipping\n", contract.Name, contract.Address)
+			continue
+		}
+		supported = append(supported, contract)
+	}
+	return supported
+}
+
+func EnabledContracts(contracts []config.Contract) []config.Contract {
+	var enabled []config.Contract
+	for _, contract := range contracts {
+		if !contract.Enabled {
+			fmt.Printf("Contract %s (%s) is disabled, skipping\n", contract.Name, contract.Address)
+			continue
+		}
+		enabled = append(enabled, contract)
+	}
+	return enabled
+}
+
+func backfillContract(ctx context.Context, cfg config.Config, db *gorm.DB, rpcClient *RPCClient, sink EventSink, contract config.Contract, r config.BlockRange) {
 	defer WG.Done()
 
-	db, err := config.GetDBInstance()
-	if err != nil {
-		fmt.Printf("Failed to get DB instance for %s: %v\n", contract.Name, err)
+	fmt.Printf("Starting backfill for contract %s (%s) blocks %d to %d\n",
+		contract.Name, contract.Address, r.FromBlock, r.ToBlock)
+
+	if !sleepStartupJitter(ctx, cfg.StartupJitter) {
+		return
+	}
+
+	for fromBlock := r.FromBlock; fromBlock <= r.ToBlock; {
+		select {
+		case <-ctx.Done():
+			return
+		case <-Shutdown:
+			return
+		default:
+		}
+
+		toBlock := fromBlock + uint64(cfg.BlockBatchSize) - 1
+		if toBlock > r.ToBlock {
+			toBlock = r.ToBlock
+		}
+
+		fmt.Printf("[%s] Backfilling blocks %d to %d\n", contract.Name, fromBlock, toBlock)
+
+		err := processBlockRange(ctx, sink, rpcClient, contract, fromBlock, toBlock, false)
+		if errors.Is(err, ErrReorgTooDeep) {
+			haltContract(contract, err)
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error backfilling block range for %s: %v\n", contract.Name, err)
+			if !sleepOrShutdown(ctx, 5*time.Second) {
+				return
+			}
+			continue
+		}
+		recordThroughput(contract, toBlock-fromBlock+1, 0)
+
+		if !cfg.DryRun {
+			advanceBackfillSyncState(db, contract, fromBlock, toBlock)
+		}
+
+		fromBlock = toBlock + 1
+	}
+
+	fmt.Printf("[%s] Backfill complete\n", contract.Name)
+}
+
+func advanceBackfillSyncState(db *gorm.DB, contract config.Contract, fromBlock, toBlock uint64) {
+	if err := recordScannedRange(db, contract, fromBlock, toBlock); err != nil {
+		fmt.Printf("Warning: failed to record scanned range %d-%d for %s: %v\n", fromBlock, toBlock, contract.Name, err)
+	}
+
+	var state config.SyncState
+	if err := db.Where("contract_address = ?", contract.Address).First(&state).Error; err != nil {
+		fmt.Printf("Error getting sync state for %s: %v\n", contract.Name, err)
 		return
 	}
 
+	if int64(toBlock) <= state.FinalizedBlock {
+		if _, err := FinalizeEvents(db, contract.Address, toBlock); err != nil {
+			fmt.Printf("Warning: failed to finalize backfilled events for %s: %v\n", contract.Name, err)
+		}
+	}
+
+	if state.LastBlock+1 < int64(fromBlock) || state.LastBlock >= int64(toBlock) {
+		return
+	}
+
+	state.LastBlock = int64(toBlock)
+	if err := db.Save(&state).Error; err != nil {
+		fmt.Printf("Error updating sync state for %s: %v\n", contract.Name, err)
+	}
+}
+
+func indexContract(ctx context.Context, cfg config.Config, db *gorm.DB, rpcClient *RPCClient, sink EventSink, contract config.Contract) {
+	defer WG.Done()
+
 	fmt.Printf("Starting indexer for contract %s (%s)\n", contract.Name, contract.Address)
 
+	if !sleepStartupJitter(ctx, cfg.StartupJitter) {
+		return
+	}
+
+	superviseContract(ctx, cfg, contract, func() error {
+		return contractLoop(ctx, cfg, db, rpcClient, sink, contract)
+	})
+}
+
+func contractLoop(ctx context.Context, cfg config.Config, db *gorm.DB, rpcClient *RPCClient, sink EventSink, contract config.Contract) error {
+	headPollInterval := cfg.HeadPollInterval
+	if contract.HeadPollInterval > 0 {
+		headPollInterval = contract.HeadPollInterval
+	}
+	rangeDelay := cfg.RangeDelay
+	if contract.RangeDelay > 0 {
+		rangeDelay = contract.RangeDelay
+	}
+
+	dryRunCursor := int64(-1)
+	pendingCursor, committedCursor := int64(-1), int64(-1)
+	pendingRanges, lastCommit := 0, time.Now()
+	failures := 0
+
+	// Progress that is pending in the buffer is committed before returning, unless the context is already gone.
+	stop := func() error {
+		if ctx.Err() == nil && pendingCursor > committedCursor {
+			commitBuffer(ctx, db, rpcClient, sink, contract, uint64(pendingCursor))
+		}
+		return nil
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		case <-Shutdown:
-			return
+			return stop()
 		default:
 		}
 
 		var state config.SyncState
 		err := db.Where("contract_address = ?", contract.Address).First(&state).Error
 		if err != nil {
-			fmt.Printf("Error getting sync state for %s: %v\n", contract.Name, err)
-			time.Sleep(5 * time.Second)
+			failures++
+			fmt.Printf("Error getting sync state for %s: %v (retry %d)\n", contract.Name, err, failures)
+			if !sleepOrShutdown(ctx, backoffDelay(failures)) {
+				return stop()
+			}
 			continue
 		}
 
+		committedBlock := uint64(state.LastBlock)
+		if cfg.DryRun && dryRunCursor > state.LastBlock {
+			state.LastBlock = dryRunCursor
+		}
+		if pendingCursor > committedCursor && pendingCursor > state.LastBlock {
+			state.LastBlock = pendingCursor
+		}
+
 		latestBlock, err := rpcClient.GetLatestBlockNumber(ctx)
 		if err != nil {
-			fmt.Printf("Error getting latest block: %v\n", err)
-			time.Sleep(5 * time.Second)
+			failures++
+			fmt.Printf("Error getting latest block: %v (retry %d)\n", err, failures)
+			if !sleepOrShutdown(ctx, backoffDelay(failures)) {
+				return stop()
+			}
 			continue
 		}
 
 		if uint64(state.LastBlock) >= latestBlock {
-			time.Sleep(5 * time.Second)
+			// At the head there is time to spare, so commit pending progress unless events are still buffering.
+			if pendingCursor > committedCursor && (bufferedCount(contract) == 0 || bufferDue(contract)) {
+				if err := flushBuffer(ctx, sink, contract); err != nil {
+					fmt.Printf("Error flushing buffered events for %s: %v\n", contract.Name, err)
+				} else if err := saveSyncState(ctx, db, rpcClient, contract, &state, committedBlock+1, uint64(pendingCursor), latestBlock); err != nil {
+					fmt.Printf("Error updating sync state for %s: %v\n", contract.Name, err)
+				} else {
+					committedCursor, pendingRanges, lastCommit = pendingCursor, 0, time.Now()
+				}
+			}
+			markCaughtUp(ctx, sink, contract)
+			failures = 0
+			if !sleepOrShutdown(ctx, headPollInterval) {
+				return stop()
+			}
 			continue
 		}
 
 		fromBlock := uint64(state.LastBlock) + 1
-		toBlock := fromBlock + uint64(cfg.BlockBatchSize) - 1
+		toBlock := fromBlock + batchSize(cfg, latestBlock-uint64(state.LastBlock)) - 1
 		if toBlock > latestBlock {
 			toBlock = latestBlock
 		}
@@ -79,191 +364,532 @@ func indexContract(ctx context.Context, cfg config.Config, rpcClient *RPCClient,
 		fmt.Printf("[%s] Processing blocks %d to %d (latest: %d)\n",
 			contract.Name, fromBlock, toBlock, latestBlock)
 
-		if err := processBlockRange(ctx, db, rpcClient, contract, fromBlock, toBlock); err != nil {
-			fmt.Printf("Error processing block range for %s: %v\n", contract.Name, err)
-			time.Sleep(5 * time.Second)
+		err = processBlockRange(ctx, sink, rpcClient, contract, fromBlock, toBlock, bufferingEnabled())
+		if errors.Is(err, ErrReorgTooDeep) {
+			haltContract(contract, err)
+			return err
+		}
+		if err != nil {
+			failures++
+			fmt.Printf("Error processing block range for %s: %v (retry %d)\n", contract.Name, err, failures)
+			if !sleepOrShutdown(ctx, backoffDelay(failures)) {
+				return stop()
+			}
 			continue
 		}
+		recordThroughput(contract, toBlock-fromBlock+1, 0)
 
-		state.LastBlock = int64(toBlock)
-		if err := db.Save(&state).Error; err != nil {
-			fmt.Printf("Error updating sync state for %s: %v\n", contract.Name, err)
-			time.Sleep(5 * time.Second)
+		if cfg.DryRun {
+			failures = 0
+			dryRunCursor = int64(toBlock)
+			if !sleepOrShutdown(ctx, rangeDelay) {
+				return stop()
+			}
 			continue
 		}
 
-		time.Sleep(100 * time.Millisecond)
+		pendingCursor = int64(toBlock)
+		pendingRanges++
+		if bufferedCount(contract) > 0 {
+			if !bufferDue(contract) {
+				failures = 0
+				if !sleepOrShutdown(ctx, rangeDelay) {
+					return stop()
+				}
+				continue
+			}
+			if err := flushBuffer(ctx, sink, contract); err != nil {
+				failures++
+				fmt.Printf("Error flushing buffered events for %s: %v (retry %d)\n", contract.Name, err, failures)
+				if !sleepOrShutdown(ctx, backoffDelay(failures)) {
+					return stop()
+				}
+				continue
+			}
+		} else if !syncStateCommitDue(cfg, pendingRanges, lastCommit) {
+			failures = 0
+			if !sleepOrShutdown(ctx, rangeDelay) {
+				return stop()
+			}
+			continue
+		}
+
+		if err := saveSyncState(ctx, db, rpcClient, contract, &state, committedBlock+1, toBlock, latestBlock); err != nil {
+			failures++
+			fmt.Printf("Error updating sync state for %s: %v (retry %d)\n", contract.Name, err, failures)
+			if !sleepOrShutdown(ctx, backoffDelay(failures)) {
+				return stop()
+			}
+			continue
+		}
+		committedCursor, pendingRanges, lastCommit = pendingCursor, 0, time.Now()
+
+		failures = 0
+		if !sleepOrShutdown(ctx, rangeDelay) {
+			return stop()
+		}
+	}
+}
+
+func syncStateCommitDue(cfg config.Config, pendingRanges int, lastCommit time.Time) bool {
+	if cfg.SyncStateCommitRanges <= 0 && cfg.SyncStateCommitInterval <= 0 {
+		return true
+	}
+	if cfg.SyncStateCommitRanges > 0 && pendingRanges >= cfg.SyncStateCommitRanges {
+		return true
+	}
+	return cfg.SyncStateCommitInterval > 0 && time.Since(lastCommit) >= cfg.SyncStateCommitInterval
+}
+
+func saveSyncState(ctx context.Context, db *gorm.DB, rpcClient *RPCClient, contract config.Contract, state *config.SyncState, fromBlock, toBlock, latestBlock uint64) error {
+	state.LastBlock = int64(toBlock)
+	if timestamp, err := rpcClient.blockTimestamp(ctx, toBlock); err == nil {
+		state.LastBlockTimestamp = int64(timestamp)
+	}
+	safe, ok := rpcClient.GetSafeBlockNumber(ctx, latestBlock)
+	safe = min(safe, toBlock)
+	if ok && int64(safe) > state.FinalizedBlock {
+		if _, err := FinalizeEvents(db, contract.Address, safe); err != nil {
+			fmt.Printf("Warning: failed to finalize events for %s through block %d: %v\n", contract.Name, safe, err)
+		} else {
+			state.FinalizedBlock = int64(safe)
+		}
+	}
+	if err := db.Save(state).Error; err != nil {
+		return err
+	}
+	if err := recordScannedRange(db, contract, fromBlock, toBlock); err != nil {
+		fmt.Printf("Warning: failed to record scanned range %d-%d for %s: %v\n", fromBlock, toBlock, contract.Name, err)
+	}
+	return nil
+}
+
+func commitBuffer(ctx context.Context, db *gorm.DB, rpcClient *RPCClient, sink EventSink, contract config.Contract, cursor uint64) {
+	if err := flushBuffer(ctx, sink, contract); err != nil {
+		fmt.Printf("Error flushing buffered events for %s on shutdown: %v\n", contract.Name, err)
+		return
+	}
+
+	var state config.SyncState
+	if err := db.Where("contract_address = ?", contract.Address).First(&state).Error; err != nil {
+		fmt.Printf("Error getting sync state for %s on shutdown: %v\n", contract.Name, err)
+		return
+	}
+	if err := saveSyncState(ctx, db, rpcClient, contract, &state, uint64(state.LastBlock)+1, cursor, cursor); err != nil {
+		fmt.Printf("Error updating sync state for %s on shutdown: %v\n", contract.Name, err)
 	}
 }
 
-func processBlockRange(ctx context.Context, db *gorm.DB, rpcClient *RPCClient, contract config.Contract, fromBlock, toBlock uint64) error {
+func haltContract(contract config.Contract, err error) {
+	fmt.Printf("FATAL: [%s] halting indexer for %s, manual intervention required: %v\n", contract.Name, contract.Address, err)
+	fmt.Printf("FATAL: [%s] no events were removed; verify the RPC endpoint and roll back manually if the reorg is genuine\n", contract.Name)
+}
+
+func batchSize(cfg config.Config, lag uint64) uint64 {
+	if cfg.MaxBatchSize <= 0 {
+		return uint64(cfg.BlockBatchSize)
+	}
+
+	size := lag / 2
+	if size < uint64(cfg.MinBatchSize) {
+		size = uint64(cfg.MinBatchSize)
+	}
+	if size > uint64(cfg.MaxBatchSize) {
+		size = uint64(cfg.MaxBatchSize)
+	}
+	return size
+}
+
+func sleepStartupJitter(ctx context.Context, jitter time.Duration) bool {
+	if jitter <= 0 {
+		return true
+	}
+
+	select {
+	case <-time.After(time.Duration(rand.Int63n(int64(jitter)))):
+		return true
+	case <-ctx.Done():
+		return false
+	case <-Shutdown:
+		return false
+	}
+}
+
+const (
+	retryBaseDelay = 5 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+func backoffDelay(failures int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < failures && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+func processBlockRange(ctx context.Context, sink EventSink, rpcClient *RPCClient, contract config.Contract, fromBlock, toBlock uint64, buffer bool) error {
+	if batch, ok := queuedRange(contract, fromBlock); ok && batch.toBlock <= toBlock {
+		fmt.Printf("[%s] Retrying store of %d events from blocks %d-%d without refetching\n", contract.Name, len(batch.entities), batch.fromBlock, batch.toBlock)
+		if err := sink.Store(ctx, contract, batch.entities); err != nil {
+			return err
+		}
+		dequeue(contract)
+		recordThroughput(contract, 0, uint64(len(batch.entities)))
+		if batch.toBlock == toBlock {
+			return nil
+		}
+		fromBlock = batch.toBlock + 1
+	}
+
+	// Ranges that end before an event's start block skip its signature, ranges past it still apply the filter when storing.
+	topics, ok := logTopics(contract, toBlock)
+	if !ok {
+		return nil
+	}
 
-	logs, err := rpcClient.GetLogs(ctx, contract.Address, fromBlock, toBlock)
+	logs, err := rpcClient.GetLogsWithTopics(ctx, contract.Address, fromBlock, toBlock, topics)
 	if err != nil {
 		return fmt.Errorf("failed to fetch logs: %w", err)
 	}
 
+	if len(logs) == 0 && config.CFG.VerifyEmptyRanges {
+		logs, err = verifyEmptyRange(ctx, rpcClient, contract, fromBlock, toBlock, topics)
+		if err != nil {
+			return fmt.Errorf("failed to verify empty range: %w", err)
+		}
+	}
+
 	if len(logs) == 0 {
 		return nil
 	}
 
 	fmt.Printf("[%s] Found %d events in blocks %d-%d\n", contract.Name, len(logs), fromBlock, toBlock)
+	return processLogs(ctx, sink, rpcClient, contract, fromBlock, toBlock, logs, buffer)
+}
 
-	blockTimestamps := make(map[uint64]uint64)
+func processLogs(ctx context.Context, sink EventSink, rpcClient *RPCClient, contract config.Contract, fromBlock, toBlock uint64, logs []types.Log, buffer bool) error {
+	// Split and per-block log queries don't guarantee order, sinks should see events in chain order.
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
 
-	var entities []interface{}
+	var entities, removed []interface{}
+	unknown := make(map[common.Hash]int)
 	for _, log := range logs {
-
-		blockNum := log.BlockNumber
-		timestamp, ok := blockTimestamps[blockNum]
-		if !ok {
-			header, err := rpcClient.GetBlockWithTimestamp(ctx, blockNum)
+		if log.Removed {
+			entity, err := ParseContractLog(contract, log, 0)
 			if err != nil {
-				fmt.Printf("Warning: failed to get block %d timestamp: %v\n", blockNum, err)
-				timestamp = uint64(time.Now().Unix())
-			} else {
-				timestamp = header.Time
+				entity = NewRawEvent(log, contract, 0)
 			}
-			blockTimestamps[blockNum] = timestamp
+			removed = append(removed, entity)
+			continue
 		}
 
-		entity, err := ParseLog(log, contract.Address, timestamp)
+		blockNum := log.BlockNumber
+		timestamp, err := rpcClient.blockTimestamp(ctx, blockNum)
+		if errors.Is(err, ErrBlockNotFound) {
+			return fmt.Errorf("block %d not available yet, retrying later: %w", blockNum, err)
+		}
 		if err != nil {
-			fmt.Printf("Warning: failed to parse log at block %d, tx %s: %v\n",
-				log.BlockNumber, log.TxHash.Hex(), err)
+			return fmt.Errorf("failed to get block %d timestamp: %w", blockNum, err)
+		}
+
+		entity, err := ParseContractLog(contract, log, timestamp)
+		if err == nil && !eventStored(contract, eventTypeName(entity), log.BlockNumber) {
 			continue
 		}
+		if errors.Is(err, ErrUnknownSignature) {
+			recordUnknownSignature(contract, log.Topics[0])
+			unknown[log.Topics[0]]++
+			entity = NewRawEvent(log, contract, timestamp)
+		} else if errors.Is(err, ErrAnonymousEvent) {
+			fmt.Printf("Warning: anonymous event at block %d, tx %s, storing raw event: %v\n",
+				log.BlockNumber, log.TxHash.Hex(), err)
+			entity = NewRawEvent(log, contract, timestamp)
+		} else if err != nil {
+			fmt.Printf("Warning: failed to parse log at block %d, tx %s, storing raw event: %v\n",
+				log.BlockNumber, log.TxHash.Hex(), err)
+			recordParseFailure(contract, log, err)
+			entity = NewRawEvent(log, contract, timestamp)
+		}
+		setStringField(entity, "Network", contract.Network)
 
 		entities = append(entities, entity)
 	}
 
+	checkUnknownSignatureRate(contract, fromBlock, toBlock, len(logs)-len(removed), unknown)
+
+	if len(removed) > 0 {
+		if err := checkReorgDepth(contract, removed, toBlock); err != nil {
+			return err
+		}
+		if buffer {
+			if err := flushBuffer(ctx, sink, contract); err != nil {
+				return fmt.Errorf("failed to flush buffered events before removal: %w", err)
+			}
+		}
+		remover, ok := sink.(EventRemover)
+		if !ok {
+			return fmt.Errorf("sink cannot remove %d logs flagged as removed", len(removed))
+		}
+		if err := remover.Remove(ctx, contract, removed); err != nil {
+			return fmt.Errorf("failed to remove reorged events: %w", err)
+		}
+		fmt.Printf("[%s] Removed %d reorged events\n", contract.Name, len(removed))
+	}
+
 	if len(entities) == 0 {
 		return nil
 	}
 
-	return storeEntities(db, entities)
+	if buffer {
+		bufferEntities(contract, entities)
+		return nil
+	}
+
+	enqueueRange(contract, entities, fromBlock, toBlock)
+	if err := sink.Store(ctx, contract, entities); err != nil {
+		return err
+	}
+	dequeue(contract)
+	recordThroughput(contract, 0, uint64(len(entities)))
+
+	return nil
 }
 
-func storeEntities(db *gorm.DB, entities []interface{}) error {
-
-	var (
-		betPlaced       []*config.BetPlaced
-		marketCreated   []*config.MarketCreated
-		marketResolved  []*config.MarketResolved
-		winningsClaimed []*config.WinningsClaimed
-		autoDeposit     []*config.AutoDepositExecuted
-		autoWithdraw    []*config.AutoWithdrawExecuted
-		ownership       []*config.OwnershipTransferred
-		paused          []*config.Paused
-		protocolReg     []*config.ProtocolRegistered
-		protocolUpd     []*config.ProtocolUpdated
-		unpaused        []*config.Unpaused
-	)
+func verifyEmptyRange(ctx context.Context, rpcClient *RPCClient, contract config.Contract, fromBlock, toBlock uint64, topics []common.Hash) ([]types.Log, error) {
+	address := common.HexToAddress(contract.Address)
 
-	for _, entity := range entities {
-		switch e := entity.(type) {
-		case *config.BetPlaced:
-			betPlaced = append(betPlaced, e)
-		case *config.MarketCreated:
-			marketCreated = append(marketCreated, e)
-		case *config.MarketResolved:
-			marketResolved = append(marketResolved, e)
-		case *config.WinningsClaimed:
-			winningsClaimed = append(winningsClaimed, e)
-		case *config.AutoDepositExecuted:
-			autoDeposit = append(autoDeposit, e)
-		case *config.AutoWithdrawExecuted:
-			autoWithdraw = append(autoWithdraw, e)
-		case *config.OwnershipTransferred:
-			ownership = append(ownership, e)
-		case *config.Paused:
-			paused = append(paused, e)
-		case *config.ProtocolRegistered:
-			protocolReg = append(protocolReg, e)
-		case *config.ProtocolUpdated:
-			protocolUpd = append(protocolUpd, e)
-		case *config.Unpaused:
-			unpaused = append(unpaused, e)
-		}
-	}
-
-	insertSlice := func(slice interface{}) error {
-		if slice == nil {
-			return nil
+	var recovered []types.Log
+	for blockNum := fromBlock; blockNum <= toBlock; blockNum++ {
+		header, err := rpcClient.GetBlockWithTimestamp(ctx, blockNum)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %d header: %w", blockNum, err)
 		}
-		return db.Clauses(clause.OnConflict{DoNothing: true}).Create(slice).Error
-	}
 
-	if len(betPlaced) > 0 {
-		if err := insertSlice(&betPlaced); err != nil {
-			return fmt.Errorf("failed to insert BetPlaced: %w", err)
+		if !types.BloomLookup(header.Bloom, address) {
+			continue
 		}
-		fmt.Printf("Inserted %d BetPlaced events\n", len(betPlaced))
-	}
-	if len(marketCreated) > 0 {
-		if err := insertSlice(&marketCreated); err != nil {
-			return fmt.Errorf("failed to insert MarketCreated: %w", err)
+
+		logs, err := rpcClient.GetLogsWithTopics(ctx, contract.Address, blockNum, blockNum, topics)
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-query block %d: %w", blockNum, err)
 		}
-		fmt.Printf("Inserted %d MarketCreated events\n", len(marketCreated))
-	}
-	if len(marketResolved) > 0 {
-		if err := insertSlice(&marketResolved); err != nil {
-			return fmt.Errorf("failed to insert MarketResolved: %w", err)
+
+		if len(logs) == 0 {
+			fmt.Printf("Warning: [%s] block %d bloom matches contract but no logs were returned\n", contract.Name, blockNum)
+			continue
 		}
-		fmt.Printf("Inserted %d MarketResolved events\n", len(marketResolved))
+
+		fmt.Printf("Warning: [%s] recovered %d logs in block %d missing from range query\n", contract.Name, len(logs), blockNum)
+		recovered = append(recovered, logs...)
 	}
-	if len(winningsClaimed) > 0 {
-		if err := insertSlice(&winningsClaimed); err != nil {
-			return fmt.Errorf("failed to insert WinningsClaimed: %w", err)
-		}
-		fmt.Printf("Inserted %d WinningsClaimed events\n", len(winningsClaimed))
+
+	return recovered, nil
+}
+
+var entityStores = []func(db *gorm.DB, entities []interface{}) error{
+	collectAndStore[config.BetPlaced],
+	collectAndStore[config.MarketCreated],
+	collectAndStore[config.MarketResolved],
+	collectAndStore[config.WinningsClaimed],
+	collectAndStore[config.MarketVaultRebalanced],
+	collectAndStore[config.AutoDepositExecuted],
+	collectAndStore[config.AutoWithdrawExecuted],
+	collectAndStore[config.OwnershipTransferred],
+	collectAndStore[config.Paused],
+	collectAndStore[config.ProtocolRegistered],
+	collectAndStore[config.ProtocolUpdated],
+	collectAndStore[config.Unpaused],
+	collectAndStore[config.AutoRebalanceEnabled],
+	collectAndStore[config.AutoRebalanceDisabled],
+	collectAndStore[config.Deposited],
+	collectAndStore[config.Withdrawn],
+	collectAndStore[config.Rebalanced],
+	collectAndStore[config.OperatorAdded],
+	collectAndStore[config.OperatorRemoved],
+	collectAndStore[config.BatchRebalanced],
+	collectAndStore[config.RawEvent],
+}
+
+func storeEntities(db *gorm.DB, contract config.Contract, entities []interface{}) error {
+	if err := insertEntities(db, entities); err != nil {
+		return err
 	}
-	if len(autoDeposit) > 0 {
-		if err := insertSlice(&autoDeposit); err != nil {
-			return fmt.Errorf("failed to insert AutoDepositExecuted: %w", err)
+	return updateDerivedState(db, contract, entities)
+}
+
+func insertEntities(db *gorm.DB, entities []interface{}) error {
+	for _, entity := range entities {
+		setEnvironment(entity, config.CFG.Environment)
+		if config.CFG.StoreBlockTime {
+			setBlockTime(entity)
 		}
-		fmt.Printf("Inserted %d AutoDepositExecuted events\n", len(autoDeposit))
 	}
-	if len(autoWithdraw) > 0 {
-		if err := insertSlice(&autoWithdraw); err != nil {
-			return fmt.Errorf("failed to insert AutoWithdrawExecuted: %w", err)
+
+	for _, store := range entityStores {
+		if err := store(db, entities); err != nil {
+			return err
 		}
-		fmt.Printf("Inserted %d AutoWithdrawExecuted events\n", len(autoWithdraw))
 	}
-	if len(ownership) > 0 {
-		if err := insertSlice(&ownership); err != nil {
-			return fmt.Errorf("failed to insert OwnershipTransferred: %w", err)
+	return nil
+}
+
+func updateDerivedState(db *gorm.DB, contract config.Contract, entities []interface{}) error {
+	if err := updateContractStatus(db, contract, entities); err != nil {
+		return fmt.Errorf("failed to update contract status: %w", err)
+	}
+	if err := updateContractOwner(db, contract, entities); err != nil {
+		return fmt.Errorf("failed to update contract owner: %w", err)
+	}
+
+	return nil
+}
+
+func collectAndStore[T any](db *gorm.DB, entities []interface{}) error {
+	var slice []*T
+	for _, entity := range entities {
+		if e, ok := entity.(*T); ok {
+			slice = append(slice, e)
 		}
-		fmt.Printf("Inserted %d OwnershipTransferred events\n", len(ownership))
 	}
-	if len(paused) > 0 {
-		if err := insertSlice(&paused); err != nil {
-			return fmt.Errorf("failed to insert Paused: %w", err)
+	if len(slice) == 0 {
+		return nil
+	}
+
+	name := eventTypeName(slice[0])
+	if err := insertSlice(db, &slice); err != nil {
+		return fmt.Errorf("failed to insert %s: %w", name, err)
+	}
+	fmt.Printf("Inserted %d %s events\n", len(slice), name)
+
+	return nil
+}
+
+func insertSlice(db *gorm.DB, slice interface{}) error {
+	onConflict := clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		UpdateAll: true,
+	}
+	if db.Dialector.Name() == "mysql" {
+		updates, err := mysqlConflictUpdates(db, slice)
+		if err != nil {
+			return err
+		}
+		if len(updates) > 0 {
+			onConflict.UpdateAll, onConflict.DoUpdates = false, updates
+		}
+	} else {
+		table := config.GetTableName(db, slice)
+		var conditions []clause.Expression
+		if !config.CFG.UpsertOnConflict {
+			conditions = append(conditions, clause.Expr{SQL: fmt.Sprintf("%s.block_hash IS DISTINCT FROM excluded.block_hash", table)})
+		}
+		if config.CFG.Confirmations > 0 {
+			conditions = append(conditions, clause.Expr{SQL: fmt.Sprintf("%s.finalized = ?", table), Vars: []interface{}{false}})
 		}
-		fmt.Printf("Inserted %d Paused events\n", len(paused))
+		if len(conditions) > 0 {
+			onConflict.Where = clause.Where{Exprs: conditions}
+		}
+	}
+	if config.CFG.InsertBatchSize <= 0 {
+		return db.Clauses(onConflict).Create(slice).Error
+	}
+	return db.Clauses(onConflict).CreateInBatches(slice, config.CFG.InsertBatchSize).Error
+}
+
+// MySQL ignores the WHERE of ON DUPLICATE KEY UPDATE, so the same conditions guard every assignment instead.
+// Assignments run left to right and see earlier results, so the columns the conditions read are assigned last.
+func mysqlConflictUpdates(db *gorm.DB, slice interface{}) ([]clause.Assignment, error) {
+	hashChanged := !config.CFG.UpsertOnConflict
+	unfinalized := config.CFG.Confirmations > 0
+	if !hashChanged && !unfinalized {
+		return nil, nil
 	}
-	if len(protocolReg) > 0 {
-		if err := insertSlice(&protocolReg); err != nil {
-			return fmt.Errorf("failed to insert ProtocolRegistered: %w", err)
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(slice); err != nil {
+		return nil, err
+	}
+
+	var conditions []string
+	if hashChanged {
+		conditions = append(conditions, "NOT (block_hash <=> VALUES(block_hash))")
+	}
+	if unfinalized {
+		conditions = append(conditions, "finalized = FALSE")
+	}
+	condition := strings.Join(conditions, " AND ")
+
+	guarded := func(column, condition string) clause.Assignment {
+		quoted := stmt.Quote(column)
+		return clause.Assignment{
+			Column: clause.Column{Name: column},
+			Value:  gorm.Expr(fmt.Sprintf("IF(%s, VALUES(%s), %s)", condition, quoted, quoted)),
 		}
-		fmt.Printf("Inserted %d ProtocolRegistered events\n", len(protocolReg))
 	}
-	if len(protocolUpd) > 0 {
-		if err := insertSlice(&protocolUpd); err != nil {
-			return fmt.Errorf("failed to insert ProtocolUpdated: %w", err)
+
+	var updates []clause.Assignment
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" || field.PrimaryKey || !field.Updatable {
+			continue
 		}
-		fmt.Printf("Inserted %d ProtocolUpdated events\n", len(protocolUpd))
+		if (hashChanged && field.DBName == "block_hash") || (unfinalized && field.DBName == "finalized") {
+			continue
+		}
+		updates = append(updates, guarded(field.DBName, condition))
+	}
+	if hashChanged {
+		updates = append(updates, guarded("block_hash", condition))
 	}
-	if len(unpaused) > 0 {
-		if err := insertSlice(&unpaused); err != nil {
-			return fmt.Errorf("failed to insert Unpaused: %w", err)
+	if unfinalized {
+		// A rewritten row now carries the incoming hash, so the hash check is inverted for the last column.
+		finalizedCondition := "finalized = FALSE"
+		if hashChanged {
+			finalizedCondition += " AND block_hash <=> VALUES(block_hash)"
 		}
-		fmt.Printf("Inserted %d Unpaused events\n", len(unpaused))
+		updates = append(updates, guarded("finalized", finalizedCondition))
 	}
+	return updates, nil
+}
 
-	return nil
+func setEnvironment(entity interface{}, environment string) {
+	setStringField(entity, "Environment", environment)
 }
 
-func SaveQueue() error {
-	return nil
+func setBlockTime(entity interface{}) {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	ts, f := v.Elem().FieldByName("BlockTimestamp"), v.Elem().FieldByName("BlockTime")
+	if !ts.IsValid() || !f.IsValid() || !f.CanSet() {
+		return
+	}
+	timestamp, ok := ts.Interface().(config.BigInt)
+	if !ok || timestamp.Sign() <= 0 {
+		return
+	}
+	blockTime := time.Unix(timestamp.Int64(), 0).UTC()
+	f.Set(reflect.ValueOf(&blockTime))
+}
+
+func setStringField(entity interface{}, name, value string) {
+	if value == "" {
+		return
+	}
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	if f := v.Elem().FieldByName(name); f.IsValid() && f.CanSet() && f.Kind() == reflect.String {
+		f.SetString(value)
+	}
 }
@@ -0,0 +1,234 @@
+package indexer
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func openMySQLDryRun(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:pass@tcp(127.0.0.1:3306)/indexer", SkipInitializeWithVersion: true}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatalf("open mysql dry run: %v", err)
+	}
+	return db
+}
+
+func TestMySQLConflictUpdatesGuardEveryColumn(t *testing.T) {
+	saved := config.CFG
+	defer func() { config.CFG = saved }()
+
+	db := openMySQLDryRun(t)
+	rows := []*config.Paused{{ID: "a"}}
+
+	tests := []struct {
+		name          string
+		upsert        bool
+		confirmations uint64
+		want          string
+		last          []string
+	}{
+		{"upsert without confirmations", true, 0, "", nil},
+		{"skip unchanged hashes", false, 0, "NOT (block_hash <=> VALUES(block_hash))", []string{"block_hash"}},
+		{"keep finalized rows", true, 3, "finalized = FALSE", []string{"finalized"}},
+		{"both", false, 3, "NOT (block_hash <=> VALUES(block_hash)) AND finalized = FALSE", []string{"block_hash", "finalized"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.CFG.UpsertOnConflict, config.CFG.Confirmations = tt.upsert, tt.confirmations
+			updates, err := mysqlConflictUpdates(db, rows)
+			if err != nil {
+				t.Fatalf("mysqlConflictUpdates: %v", err)
+			}
+			if tt.want == "" {
+				if len(updates) != 0 {
+					t.Fatalf("expected plain UpdateAll, got %d guarded assignments", len(updates))
+				}
+				return
+			}
+
+			sql := db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "id"}}, DoUpdates: updates}).
+				Create(rows).Statement.SQL.String()
+			if !strings.Contains(sql, "`account`=IF("+tt.want+", VALUES(`account`), `account`)") {
+				t.Errorf("account is not guarded by %q:\n%s", tt.want, sql)
+			}
+			for i, column := range tt.last {
+				if got := updates[len(updates)-len(tt.last)+i].Column.Name; got != column {
+					t.Errorf("assignment %d from the end is %s, want %s", len(tt.last)-i, got, column)
+				}
+			}
+		})
+	}
+}
+
+func TestContractLoopStopsDuringBackoff(t *testing.T) {
+	// Without a sync_states table every iteration fails and backs off.
+	db := openTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- contractLoop(ctx, config.Config{}, db, nil, nil, config.Contract{Name: "WhizyPredictionMarket"})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("contractLoop returned %v, want nil on shutdown", err)
+		}
+	case <-time.After(retryBaseDelay / 2):
+		t.Fatal("contractLoop kept sleeping after the context was cancelled")
+	}
+}
+
+func TestStoreEntitiesMixedBatch(t *testing.T) {
+	saved := config.CFG
+	defer func() { config.CFG = saved }()
+	config.CFG.UpsertOnConflict = false
+	config.CFG.Confirmations = 1
+
+	db := statsTestDB(t).db
+	contract := config.Contract{Name: "WhizyPredictionMarket", Address: "0x00000000000000000000000000000000000000aa"}
+
+	bet := testBet("bet-1", 10)
+	bet.BlockHash = "0xh1"
+	market := &config.MarketCreated{
+		ID:              "market-1",
+		MarketID:        config.NewBigInt(1),
+		Question:        "q",
+		EndTime:         config.NewBigInt(1800000000),
+		TokenAddress:    "0x01",
+		VaultAddress:    "0x02",
+		BlockNumber:     config.NewBigInt(10),
+		BlockHash:       "0xh1",
+		BlockTimestamp:  config.NewBigInt(1700000000),
+		TransactionHash: "0xm1",
+	}
+	operators := []interface{}{
+		&config.OperatorAdded{ID: "op-1", Operator: "0x03", BlockNumber: config.NewBigInt(11), BlockTimestamp: config.NewBigInt(1), TransactionHash: "0xo1"},
+		&config.OperatorAdded{ID: "op-2", Operator: "0x04", BlockNumber: config.NewBigInt(11), BlockTimestamp: config.NewBigInt(1), TransactionHash: "0xo2"},
+	}
+	raw := &config.RawEvent{ID: "raw-1", ContractAddress: contract.Address, Topics: "[]", Data: "0x", BlockNumber: config.NewBigInt(12), BlockTimestamp: config.NewBigInt(1), TransactionHash: "0xr1"}
+
+	if err := storeEntities(db, contract, append([]interface{}{bet, market, raw}, operators...)); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	for model, want := range map[interface{}]int64{
+		&config.BetPlaced{}: 1, &config.MarketCreated{}: 1, &config.OperatorAdded{}: 2, &config.RawEvent{}: 1, &config.Paused{}: 0,
+	} {
+		var count int64
+		if err := db.Model(model).Count(&count).Error; err != nil {
+			t.Fatalf("count: %v", err)
+		}
+		if count != want {
+			t.Errorf("%s: %d rows, want %d", config.GetTableName(db, model), count, want)
+		}
+	}
+
+	amountOf := func() int64 {
+		var stored config.BetPlaced
+		if err := db.First(&stored, "id = ?", "bet-1").Error; err != nil {
+			t.Fatalf("read bet: %v", err)
+		}
+		return stored.Amount.Int64()
+	}
+
+	// A replay of the same block keeps the stored row.
+	replay := testBet("bet-1", 10)
+	replay.BlockHash, replay.Amount = "0xh1", config.NewBigInt(6)
+	if err := storeEntities(db, contract, []interface{}{replay}); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if got := amountOf(); got != 5 {
+		t.Errorf("replay with the same block hash changed amount to %d", got)
+	}
+
+	// A reorged block replaces it.
+	reorged := testBet("bet-1", 10)
+	reorged.BlockHash, reorged.Amount = "0xh2", config.NewBigInt(7)
+	if err := storeEntities(db, contract, []interface{}{reorged}); err != nil {
+		t.Fatalf("reorg: %v", err)
+	}
+	if got := amountOf(); got != 7 {
+		t.Errorf("reorged block left amount at %d, want 7", got)
+	}
+
+	// Finalized rows are never overwritten.
+	if err := db.Model(&config.BetPlaced{}).Where("id = ?", "bet-1").Update("finalized", true).Error; err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+	late := testBet("bet-1", 10)
+	late.BlockHash, late.Amount = "0xh3", config.NewBigInt(8)
+	if err := storeEntities(db, contract, []interface{}{late}); err != nil {
+		t.Fatalf("store after finalize: %v", err)
+	}
+	if got := amountOf(); got != 7 {
+		t.Errorf("finalized row changed amount to %d", got)
+	}
+}
+
+func TestCaughtUpIgnoresDroppedContracts(t *testing.T) {
+	savedState, savedChan := catchUp.pending, CaughtUp
+	defer func() {
+		catchUp.pending, CaughtUp = savedState, savedChan
+		catchUp.registered, catchUp.started, catchUp.closed = false, false, false
+	}()
+	catchUp.pending = make(map[string]bool)
+	catchUp.registered, catchUp.started, catchUp.closed = false, false, false
+	CaughtUp = make(chan struct{})
+
+	fast := config.Contract{Name: "WhizyPredictionMarket", Address: "0x00000000000000000000000000000000000000aa"}
+	halted := config.Contract{Name: "ProtocolSelector", Address: "0x00000000000000000000000000000000000000bb"}
+	closed := func() bool {
+		select {
+		case <-CaughtUp:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// The first contract catches up before the second has even been registered.
+	expectCatchUp(fast)
+	markCaughtUp(context.Background(), nil, fast)
+	expectCatchUp(halted)
+	catchUpStarted()
+	if closed() {
+		t.Fatal("CaughtUp closed while a started contract was still behind")
+	}
+
+	dropCatchUp(halted)
+	if !closed() {
+		t.Fatal("CaughtUp stayed open after the last pending contract halted")
+	}
+}
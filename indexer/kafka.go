@@ -0,0 +1,151 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	kafkaQueueSize   = 1024
+	kafkaMaxAttempts = 5
+)
+
+var kafkaDropped = expvar.NewMap("kafka_dropped")
+
+type KafkaSink struct {
+	writer *kafka.Writer
+	queue  chan []kafka.Message
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	s := &KafkaSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &entityKeyBalancer{},
+			RequiredAcks: kafka.RequireAll,
+		},
+		queue: make(chan []kafka.Message, kafkaQueueSize),
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+func (s *KafkaSink) Store(ctx context.Context, contract config.Contract, entities []interface{}) error {
+	messages := make([]kafka.Message, 0, len(entities))
+	for _, entity := range entities {
+		value, err := json.Marshal(entity)
+		if err != nil {
+			fmt.Printf("Warning: failed to encode %s for Kafka: %v\n", eventTypeName(entity), err)
+			continue
+		}
+		messages = append(messages, kafkaMessage(contract, entity, value))
+	}
+	return s.enqueue(contract, messages)
+}
+
+func (s *KafkaSink) Remove(ctx context.Context, contract config.Contract, entities []interface{}) error {
+	// A nil value is a tombstone, compacted topics drop the entity's earlier message.
+	messages := make([]kafka.Message, 0, len(entities))
+	for _, entity := range entities {
+		messages = append(messages, kafkaMessage(contract, entity, nil))
+	}
+	return s.enqueue(contract, messages)
+}
+
+func kafkaMessage(contract config.Contract, entity interface{}, value []byte) kafka.Message {
+	eventType := eventTypeName(entity)
+	return kafka.Message{
+		Key:   []byte(contract.Name + ":" + eventType + ":" + entityID(entity)),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "contract", Value: []byte(contract.Address)},
+			{Key: "event_type", Value: []byte(eventType)},
+		},
+	}
+}
+
+func (s *KafkaSink) enqueue(contract config.Contract, messages []kafka.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		kafkaDropped.Add("closed", int64(len(messages)))
+		return nil
+	}
+
+	// Kafka is best effort, a full queue drops the batch rather than holding back indexing.
+	select {
+	case s.queue <- messages:
+	default:
+		kafkaDropped.Add("queue_full", int64(len(messages)))
+		fmt.Printf("Warning: Kafka queue full, dropping %d events for %s\n", len(messages), contract.Name)
+	}
+	return nil
+}
+
+type entityKeyBalancer struct {
+	hash kafka.Hash
+}
+
+func (b *entityKeyBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	// Keys end with the entity id, partitioning on the rest keeps each contract's event type in order.
+	if i := bytes.LastIndexByte(msg.Key, ':'); i >= 0 {
+		msg.Key = msg.Key[:i]
+	}
+	return b.hash.Balance(msg, partitions...)
+}
+
+func (s *KafkaSink) run() {
+	defer s.wg.Done()
+
+	for messages := range s.queue {
+		delay := time.Second
+		for attempt := 1; ; attempt++ {
+			err := s.writer.WriteMessages(context.Background(), messages...)
+			if err == nil {
+				break
+			}
+			if attempt >= kafkaMaxAttempts {
+				kafkaDropped.Add("publish_failed", int64(len(messages)))
+				fmt.Printf("Error publishing %d events to Kafka after %d attempts: %v\n", len(messages), attempt, err)
+				break
+			}
+			fmt.Printf("Warning: failed to publish to Kafka (attempt %d): %v\n", attempt, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
+
+func (s *KafkaSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return s.writer.Close()
+}
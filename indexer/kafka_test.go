@@ -0,0 +1,93 @@
+package indexer
+
+import (
+	"context"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestKafkaSinkDropsWhenQueueIsFull(t *testing.T) {
+	// No worker drains this queue, so the second batch has nowhere to go.
+	sink := &KafkaSink{queue: make(chan []kafka.Message, 1)}
+	contract := config.Contract{Name: "ProtocolSelector", Address: "0x00000000000000000000000000000000000000aa"}
+	dropped := func() int64 {
+		if v, ok := kafkaDropped.Get("queue_full").(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := dropped()
+
+	if err := sink.Store(context.Background(), contract, []interface{}{&config.Paused{ID: "a"}}); err != nil {
+		t.Fatalf("first store: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sink.Store(context.Background(), contract, []interface{}{&config.Paused{ID: "b"}, &config.Paused{ID: "c"}})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("store into a full queue: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("store into a full queue blocked")
+	}
+
+	if got := dropped() - before; got != 2 {
+		t.Errorf("dropped %d events, want 2", got)
+	}
+	if queued := len(sink.queue); queued != 1 {
+		t.Errorf("queue holds %d batches, want 1", queued)
+	}
+}
+
+func TestKafkaSinkStoreAfterClose(t *testing.T) {
+	sink := &KafkaSink{queue: make(chan []kafka.Message, 1), writer: &kafka.Writer{}}
+	sink.wg.Add(1)
+	go sink.run()
+	contract := config.Contract{Name: "ProtocolSelector", Address: "0x00000000000000000000000000000000000000aa"}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := sink.Store(context.Background(), contract, []interface{}{&config.Paused{ID: "a"}}); err != nil {
+		t.Fatalf("store after close: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
+
+func TestKafkaSinkRemovePublishesTombstones(t *testing.T) {
+	sink := &KafkaSink{queue: make(chan []kafka.Message, 2)}
+	contract := config.Contract{Name: "ProtocolSelector", Address: "0x00000000000000000000000000000000000000aa"}
+	entity := &config.Paused{ID: "0xabc-1"}
+
+	if err := sink.Store(context.Background(), contract, []interface{}{entity}); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if err := sink.Remove(context.Background(), contract, []interface{}{entity}); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	stored, removed := (<-sink.queue)[0], (<-sink.queue)[0]
+	if string(stored.Key) != "ProtocolSelector:Paused:0xabc-1" || stored.Value == nil {
+		t.Errorf("stored message key %q, value %q", stored.Key, stored.Value)
+	}
+	if string(removed.Key) != string(stored.Key) || removed.Value != nil {
+		t.Errorf("tombstone key %q, value %q, want the stored key and a nil value", removed.Key, removed.Value)
+	}
+
+	balancer := &entityKeyBalancer{}
+	partitions := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	other := kafka.Message{Key: []byte("ProtocolSelector:Paused:0xdef-9")}
+	if balancer.Balance(stored, partitions...) != balancer.Balance(other, partitions...) {
+		t.Error("events of the same contract and type landed on different partitions")
+	}
+}
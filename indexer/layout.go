@@ -0,0 +1,133 @@
+package indexer
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm/schema"
+)
+
+var logMetadataColumns = map[string]bool{
+	"id":               true,
+	"block_number":     true,
+	"log_index":        true,
+	"block_hash":       true,
+	"block_timestamp":  true,
+	"transaction_hash": true,
+	"environment":      true,
+	"finalized":        true,
+	"network":          true,
+	"block_time":       true,
+}
+
+func applyDataLayout(contract config.Contract, log types.Log, entity interface{}) error {
+	value := reflect.ValueOf(entity)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	eventName := value.Elem().Type().Name()
+
+	layout := contract.DataLayoutAt(log.BlockNumber, eventName)
+	if len(layout) == 0 {
+		return nil
+	}
+
+	// Columns listed in the layout replace whatever the default parser read from the standard ABI words.
+	for column, field := range layout {
+		if field.Offset+field.Length > len(log.Data) {
+			return fmt.Errorf("%s layout field %s needs bytes %d-%d, log has %d data bytes",
+				eventName, column, field.Offset, field.Offset+field.Length, len(log.Data))
+		}
+		target, ok := layoutTarget(value.Elem(), column)
+		if !ok {
+			return fmt.Errorf("%s has no data column %s", eventName, column)
+		}
+		if err := setLayoutField(target, log.Data[field.Offset:field.Offset+field.Length]); err != nil {
+			return fmt.Errorf("%s layout field %s: %w", eventName, column, err)
+		}
+	}
+	return nil
+}
+
+func layoutTarget(entity reflect.Value, column string) (reflect.Value, bool) {
+	if logMetadataColumns[column] {
+		return reflect.Value{}, false
+	}
+	for i := 0; i < entity.NumField(); i++ {
+		tags := schema.ParseTagSetting(entity.Type().Field(i).Tag.Get("gorm"), ";")
+		if tags["COLUMN"] == column {
+			return entity.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func setLayoutField(target reflect.Value, data []byte) error {
+	switch target.Interface().(type) {
+	case config.BigInt:
+		target.Set(reflect.ValueOf(config.BigInt{Int: new(big.Int).SetBytes(data)}))
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.Bool:
+		target.SetBool(!wordIsZero(data))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := new(big.Int).SetBytes(data)
+		if n.BitLen() > target.Type().Bits() {
+			return fmt.Errorf("value %s overflows %s", n, target.Type())
+		}
+		target.SetUint(n.Uint64())
+	case reflect.String:
+		if len(data) != 20 && len(data) != 32 {
+			return fmt.Errorf("string columns hold addresses and need 20 or 32 bytes, got %d", len(data))
+		}
+		target.SetString(addressHex(data))
+	default:
+		return fmt.Errorf("unsupported column type %s", target.Type())
+	}
+	return nil
+}
+
+func warnInvalidDataLayouts(contracts []config.Contract) {
+	for _, contract := range contracts {
+		for _, version := range contract.ABIVersions {
+			events := make([]string, 0, len(version.Layouts))
+			for event := range version.Layouts {
+				events = append(events, event)
+			}
+			sort.Strings(events)
+
+			for _, event := range events {
+				entity, ok := eventEntity(contract.Name, event)
+				if !ok {
+					fmt.Printf("Warning: abi version %s of %s has a layout for unknown event %s\n", version.Name, contract.Name, event)
+					continue
+				}
+				for column := range version.Layouts[event] {
+					if _, ok := layoutTarget(entity, column); !ok {
+						fmt.Printf("Warning: abi version %s of %s has a layout for unknown %s column %s\n", version.Name, contract.Name, event, column)
+					}
+				}
+			}
+		}
+	}
+}
+
+func eventEntity(contractName, eventName string) (reflect.Value, bool) {
+	for _, model := range config.EventTables() {
+		t := reflect.TypeOf(model).Elem()
+		if t.Name() != eventName {
+			continue
+		}
+		if _, ok := EventSignature(contractName, eventName); !ok {
+			return reflect.Value{}, false
+		}
+		return reflect.New(t).Elem(), true
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/evaafi/go-indexer/config"
+)
+
+func TestApplyDataLayoutPackedBetPlaced(t *testing.T) {
+	contract := benchContract("WhizyPredictionMarket")
+	contract.ABIVersions = []config.ABIVersion{{
+		Name:      "packed",
+		FromBlock: 100,
+		Layouts: map[string]map[string]config.DataField{
+			"BetPlaced": {
+				"position": {Offset: 0, Length: 1},
+				"amount":   {Offset: 1, Length: 16},
+				"shares":   {Offset: 17, Length: 16},
+			},
+		},
+	}}
+
+	// bool, uint128, uint128 packed into 33 bytes, too short for the default three-word decoding.
+	amount, shares := big.NewInt(1_500_000), big.NewInt(1_234_567)
+	data := append([]byte{1}, common.LeftPadBytes(amount.Bytes(), 16)...)
+	data = append(data, common.LeftPadBytes(shares.Bytes(), 16)...)
+
+	log := types.Log{
+		Address:     common.HexToAddress(contract.Address),
+		Topics:      []common.Hash{BetPlacedSignature, common.BigToHash(big.NewInt(7)), common.BytesToHash(common.HexToAddress("0x00000000000000000000000000000000000000bb").Bytes())},
+		Data:        data,
+		BlockNumber: 150,
+		TxHash:      common.BigToHash(big.NewInt(2)),
+	}
+
+	entity, err := ParseContractLog(contract, log, 1700000000)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	bet, ok := entity.(*config.BetPlaced)
+	if !ok {
+		t.Fatalf("parsed %T, want *config.BetPlaced", entity)
+	}
+	if bet.Amount.Int == nil || bet.Amount.Sign() == 0 || bet.Amount.Int.Cmp(amount) != 0 {
+		t.Errorf("amount %v, want %s", bet.Amount.Int, amount)
+	}
+	if bet.Shares.Int == nil || bet.Shares.Sign() == 0 || bet.Shares.Int.Cmp(shares) != 0 {
+		t.Errorf("shares %v, want %s", bet.Shares.Int, shares)
+	}
+	if !bet.Position || bet.MarketID.Int64() != 7 {
+		t.Errorf("position %v, market %s", bet.Position, bet.MarketID)
+	}
+
+	// Before the version's fromBlock the packed data is not decoded.
+	log.BlockNumber = 99
+	entity, err = ParseContractLog(contract, log, 1700000000)
+	if err != nil {
+		t.Fatalf("parse before layout: %v", err)
+	}
+	if entity.(*config.BetPlaced).Amount.Sign() != 0 {
+		t.Errorf("layout applied before its fromBlock")
+	}
+}
@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/evaafi/go-indexer/config"
+)
+
+const debugDataPrefixLen = 64
+
+var (
+	parseFailures          = expvar.NewMap("parse_failures")
+	unknownSignatures      = expvar.NewMap("unknown_signatures")
+	unknownSignatureHashes = expvar.NewMap("unknown_signature_hashes")
+	unknownSignatureRatio  = expvar.NewMap("unknown_signature_ratio")
+	rpcErrors              = expvar.NewMap("rpc_errors")
+	contractStates         = expvar.NewMap("contract_states")
+	contractRestarts       = expvar.NewMap("contract_restarts")
+)
+
+const (
+	contractRunning    = "running"
+	contractRestarting = "restarting"
+	contractHalted     = "halted"
+	contractStopped    = "stopped"
+	contractFailed     = "failed"
+)
+
+func setContractState(contract config.Contract, state string) {
+	value := new(expvar.String)
+	value.Set(state)
+	contractStates.Set(contract.Name, value)
+}
+
+func recordUnknownSignature(contract config.Contract, signature common.Hash) {
+	unknownSignatures.Add(contract.Name, 1)
+	unknownSignatureHashes.Add(contract.Name+"/"+signature.Hex(), 1)
+}
+
+func checkUnknownSignatureRate(contract config.Contract, fromBlock, toBlock uint64, total int, unknown map[common.Hash]int) {
+	if total == 0 {
+		return
+	}
+
+	count := 0
+	for _, n := range unknown {
+		count += n
+	}
+	ratio := float64(count) / float64(total)
+
+	value := new(expvar.Float)
+	value.Set(ratio)
+	unknownSignatureRatio.Set(contract.Name, value)
+
+	if count == 0 || ratio < config.CFG.UnknownSignatureThreshold {
+		return
+	}
+
+	signatures := make([]string, 0, len(unknown))
+	for signature, n := range unknown {
+		signatures = append(signatures, fmt.Sprintf("%s (%d)", signature.Hex(), n))
+	}
+	sort.Strings(signatures)
+	fmt.Printf("ALERT: [%s] %d of %d logs in blocks %d-%d have unknown signatures (%.0f%%), possible ABI mismatch: %s\n",
+		contract.Name, count, total, fromBlock, toBlock, ratio*100, strings.Join(signatures, ", "))
+}
+
+func recordParseFailure(contract config.Contract, log types.Log, err error) {
+	signature := "none"
+	if len(log.Topics) > 0 {
+		signature = log.Topics[0].Hex()
+	}
+	parseFailures.Add(contract.Name+"/"+signature, 1)
+
+	if config.CFG.Debug {
+		data := log.Data
+		if len(data) > debugDataPrefixLen {
+			data = data[:debugDataPrefixLen]
+		}
+		fmt.Printf("Debug: [%s] parse failure for %s at block %d, tx %s, data prefix %s: %v\n",
+			contract.Name, signature, log.BlockNumber, log.TxHash.Hex(), hexutil.Encode(data), err)
+	}
+}
+
+func reportParseFailures(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-Shutdown:
+			return
+		case <-ticker.C:
+			parseFailures.Do(func(kv expvar.KeyValue) {
+				fmt.Printf("Parse failures %s: %s\n", kv.Key, kv.Value.String())
+			})
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package indexer
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm/schema"
+)
+
+type openAPISchemas struct {
+	components map[string]interface{}
+	named      map[reflect.Type]string
+}
+
+func OpenAPISpec() map[string]interface{} {
+	s := &openAPISchemas{
+		components: make(map[string]interface{}),
+		named:      make(map[reflect.Type]string),
+	}
+
+	models := append(config.EventTables(), &config.RawEvent{}, &config.ContractStatus{},
+		&FormattedBet{}, &MarketVaultActivity{}, &TimelineEntry{}, &ContractSyncStatus{})
+	for _, model := range models {
+		t := reflect.TypeOf(model).Elem()
+		s.named[t] = t.Name()
+	}
+	// Components are generated after every name is known, so fields can reference any model.
+	for _, model := range models {
+		t := reflect.TypeOf(model).Elem()
+		s.components[t.Name()] = s.object(t)
+	}
+
+	list := func(name string) map[string]interface{} {
+		return map[string]interface{}{"type": "array", "items": ref(name)}
+	}
+	query := func(name, description string, required bool) map[string]interface{} {
+		return map[string]interface{}{
+			"name": name, "in": "query", "required": required, "description": description,
+			"schema": map[string]interface{}{"type": "string"},
+		}
+	}
+
+	paths := map[string]interface{}{
+		"/bets": get("List bets, oldest first", s.schema(reflect.TypeOf(Page[FormattedBet]{})),
+			query("market", "Market ID", false), query("user", "Bettor address", false),
+			query("cursor", "nextCursor of the previous page", false), query("limit", "Page size", false)),
+		"/markets/search": get("Search markets by question", list("MarketCreated"),
+			query("q", "Search terms", true)),
+		"/markets/vault-rebalances": get("Vault rebalances per market", list("MarketVaultActivity"),
+			query("market", "Market ID", false)),
+		"/users/timeline": get("Every event involving an address, oldest first", list("TimelineEntry"),
+			query("address", "User, operator or account address", true),
+			query("fromBlock", "First block, inclusive", false), query("toBlock", "Last block, inclusive", false)),
+		"/contract-status": get("Pause status per contract", list("ContractStatus")),
+		"/sync-status":     get("Sync progress per contract", list("ContractSyncStatus")),
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Whizy indexer API",
+			"version": "1",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": s.components},
+	}
+}
+
+func get(summary string, response map[string]interface{}, params ...map[string]interface{}) map[string]interface{} {
+	op := map[string]interface{}{
+		"summary": summary,
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "OK",
+				"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": response}},
+			},
+		},
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	return map[string]interface{}{"get": op}
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func (s *openAPISchemas) schema(t reflect.Type) map[string]interface{} {
+	if name, ok := s.named[t]; ok {
+		return ref(name)
+	}
+
+	switch t {
+	case reflect.TypeOf(config.BigInt{}):
+		// BigInt is serialized as a decimal string, uint256 values don't fit a JSON number.
+		return map[string]interface{}{"type": "string", "pattern": "^-?[0-9]+$"}
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if names, ok := config.EnumNames(reflect.Zero(t).Interface()); ok {
+		return map[string]interface{}{"type": "string", "enum": names}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		inner := s.schema(t.Elem())
+		if _, isRef := inner["$ref"]; isRef {
+			return map[string]interface{}{"allOf": []interface{}{inner}, "nullable": true}
+		}
+		inner["nullable"] = true
+		return inner
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		return s.object(t)
+	}
+	// interface{} fields such as TimelineEntry.Event hold any event model.
+	return map[string]interface{}{}
+}
+
+func (s *openAPISchemas) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	s.fields(t, properties, &required)
+
+	object := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+func (s *openAPISchemas) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			s.fields(field.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := s.schema(field.Type)
+		tags := schema.ParseTagSetting(field.Tag.Get("gorm"), ";")
+		if column := tags["COLUMN"]; column != "" {
+			if _, isRef := property["$ref"]; isRef {
+				property = map[string]interface{}{"allOf": []interface{}{property}}
+			}
+			property["x-column"] = column
+			if _, ok := tags["PRIMARYKEY"]; ok {
+				property["x-primary-key"] = true
+				property["x-indexed"] = true
+			}
+			if _, ok := tags["INDEX"]; ok {
+				property["x-indexed"] = true
+			}
+			if _, ok := tags["UNIQUEINDEX"]; ok {
+				property["x-indexed"] = true
+			}
+			if _, ok := tags["NOT NULL"]; ok && opts != "omitempty" {
+				*required = append(*required, name)
+			}
+		}
+		properties[name] = property
+	}
+}
@@ -0,0 +1,98 @@
+package indexer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+)
+
+func GetCurrentOwner(db *gorm.DB, contractAddress string) (config.ContractOwner, error) {
+	var owner config.ContractOwner
+	err := db.Where("LOWER(contract_address) = LOWER(?)", contractAddress).First(&owner).Error
+	return owner, err
+}
+
+func GetOwnershipHistory(db *gorm.DB, contractAddress string) ([]config.OwnershipTransferred, error) {
+	contract, ok := contractByAddress(contractAddress)
+	if !ok {
+		return nil, fmt.Errorf("unknown contract address %s", contractAddress)
+	}
+
+	var transfers []config.OwnershipTransferred
+	if err := ownershipQuery(db, contract).Order("block_number, log_index").Find(&transfers).Error; err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func ownershipQuery(db *gorm.DB, contract config.Contract) *gorm.DB {
+	// OwnershipTransferred rows carry no contract address, each network has a single ProtocolSelector.
+	q := db.Model(&config.OwnershipTransferred{})
+	if contract.Network != "" {
+		q = q.Where("network = ?", contract.Network)
+	}
+	if config.CFG.Environment != "" {
+		q = q.Where("environment = ?", config.CFG.Environment)
+	}
+	return q
+}
+
+func updateContractOwner(db *gorm.DB, contract config.Contract, entities []interface{}) error {
+	var latest *config.OwnershipTransferred
+	for _, entity := range entities {
+		e, ok := entity.(*config.OwnershipTransferred)
+		if !ok {
+			continue
+		}
+		if latest == nil || e.BlockNumber.Cmp(latest.BlockNumber) > 0 ||
+			(e.BlockNumber.Cmp(latest.BlockNumber) == 0 && e.LogIndex > latest.LogIndex) {
+			latest = e
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+
+	owner := config.ContractOwner{
+		ContractAddress: contract.Address,
+		ContractName:    contract.Name,
+		Owner:           latest.NewOwner,
+		PreviousOwner:   latest.PreviousOwner,
+		SinceBlock:      latest.BlockNumber.Int64(),
+		SinceLogIndex:   latest.LogIndex,
+		TransactionHash: latest.TransactionHash,
+		Environment:     config.CFG.Environment,
+		Network:         contract.Network,
+		UpdatedAt:       time.Now(),
+	}
+
+	// Events can arrive out of order around a reorg, the transfer at the highest block wins.
+	return upsertIfLater(db, &owner, owner.ContractAddress, owner.SinceBlock, owner.SinceLogIndex)
+}
+
+func hasOwnershipEvents(entities []interface{}) bool {
+	for _, entity := range entities {
+		if _, ok := entity.(*config.OwnershipTransferred); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func rebuildContractOwner(db *gorm.DB, contract config.Contract) error {
+	var latest config.OwnershipTransferred
+	result := ownershipQuery(db, contract).Order("block_number DESC, log_index DESC").Limit(1).Find(&latest)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if err := db.Where("contract_address = ?", contract.Address).Delete(&config.ContractOwner{}).Error; err != nil {
+		return err
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	return updateContractOwner(db, contract, []interface{}{&latest})
+}
@@ -0,0 +1,41 @@
+package indexer
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/evaafi/go-indexer/config"
+)
+
+func TestUpdateContractOwnerKeepsLatestTransfer(t *testing.T) {
+	db := openTestDB(t, &config.ContractOwner{})
+	contract := config.Contract{Name: "ProtocolSelector", Address: "0x00000000000000000000000000000000000000aa"}
+
+	transfer := func(owner string, block int64, logIndex uint) *config.OwnershipTransferred {
+		return &config.OwnershipTransferred{
+			NewOwner:    owner,
+			BlockNumber: config.BigInt{Int: big.NewInt(block)},
+			LogIndex:    logIndex,
+		}
+	}
+	batches := []struct {
+		entities []interface{}
+		want     string
+	}{
+		{[]interface{}{transfer("0xb", 100, 1), transfer("0xa", 99, 0)}, "0xb"},
+		{[]interface{}{transfer("0xc", 100, 0)}, "0xb"},
+		{[]interface{}{transfer("0xd", 100, 2)}, "0xd"},
+	}
+	for i, batch := range batches {
+		if err := updateContractOwner(db, contract, batch.entities); err != nil {
+			t.Fatalf("batch %d: update: %v", i, err)
+		}
+		owner, err := GetCurrentOwner(db, contract.Address)
+		if err != nil {
+			t.Fatalf("batch %d: read: %v", i, err)
+		}
+		if owner.Owner != batch.want {
+			t.Errorf("batch %d: owner = %s, want %s", i, owner.Owner, batch.want)
+		}
+	}
+}
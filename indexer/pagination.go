@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+)
+
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type pageCursor struct {
+	BlockNumber string `json:"b"`
+	LogIndex    uint   `json:"l"`
+}
+
+func EncodeCursor(blockNumber config.BigInt, logIndex uint) string {
+	data, _ := json.Marshal(pageCursor{BlockNumber: blockNumber.String(), LogIndex: logIndex})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return c, nil
+}
+
+func Paginate[T any](query *gorm.DB, cursor string, limit int) (Page[T], error) {
+	var page Page[T]
+	if limit <= 0 {
+		limit = 100
+	}
+
+	if cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		query = query.Where("(block_number, log_index) > (?, ?)", c.BlockNumber, c.LogIndex)
+	}
+
+	var items []T
+	err := query.Order("block_number, log_index").Limit(limit + 1).Find(&items).Error
+	if err != nil {
+		return page, err
+	}
+
+	if len(items) > limit {
+		items = items[:limit]
+		blockNumber, logIndex := cursorFields(&items[limit-1])
+		page.NextCursor = EncodeCursor(blockNumber, logIndex)
+	}
+	page.Items = items
+
+	return page, nil
+}
+
+func cursorFields(entity interface{}) (config.BigInt, uint) {
+	v := reflect.ValueOf(entity).Elem()
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	blockNumber, _ := v.FieldByName("BlockNumber").Interface().(config.BigInt)
+	logIndex, _ := v.FieldByName("LogIndex").Interface().(uint)
+	return blockNumber, logIndex
+}
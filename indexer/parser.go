@@ -1,22 +1,26 @@
 package indexer
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
+	"reflect"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/evaafi/go-indexer/config"
 )
 
 var (
-	BetPlacedSignature          common.Hash
-	MarketCreatedSignature      common.Hash
-	MarketResolvedSignature     common.Hash
-	WinningsClaimedSignature    common.Hash
+	BetPlacedSignature             common.Hash
+	MarketCreatedSignature         common.Hash
+	MarketResolvedSignature        common.Hash
+	WinningsClaimedSignature       common.Hash
 	MarketVaultRebalancedSignature common.Hash
+	BatchRebalancedSignature       common.Hash
 
 	AutoDepositExecutedSignature  common.Hash
 	AutoWithdrawExecutedSignature common.Hash
@@ -35,6 +39,15 @@ var (
 	OperatorRemovedSignature       common.Hash
 )
 
+// ProtocolSelectorV1 names the ABI version of ProtocolSelector before its upgrade, when ProtocolRegistered
+// had no indexed parameters. List it in the contract's abiVersions from its startBlock up to the upgrade block.
+const ProtocolSelectorV1 = "protocol-selector-v1"
+
+var (
+	ErrUnknownSignature = errors.New("unknown event signature")
+	ErrMalformedLog     = errors.New("malformed log")
+)
+
 func init() {
 
 	BetPlacedSignature = crypto.Keccak256Hash([]byte("BetPlaced(uint256,address,bool,uint256,uint256)"))
@@ -42,6 +55,7 @@ func init() {
 	MarketResolvedSignature = crypto.Keccak256Hash([]byte("MarketResolved(uint256,bool)"))
 	WinningsClaimedSignature = crypto.Keccak256Hash([]byte("WinningsClaimed(uint256,address,uint256)"))
 	MarketVaultRebalancedSignature = crypto.Keccak256Hash([]byte("MarketVaultRebalanced(uint256,uint256)"))
+	BatchRebalancedSignature = crypto.Keccak256Hash([]byte("BatchRebalanced(uint256[],uint256[])"))
 
 	AutoDepositExecutedSignature = crypto.Keccak256Hash([]byte("AutoDepositExecuted(address,address,uint256,bool)"))
 	AutoWithdrawExecutedSignature = crypto.Keccak256Hash([]byte("AutoWithdrawExecuted(address,address,uint256,bool)"))
@@ -58,74 +72,165 @@ func init() {
 	RebalancedSignature = crypto.Keccak256Hash([]byte("Rebalanced(address,address,uint256)"))
 	OperatorAddedSignature = crypto.Keccak256Hash([]byte("OperatorAdded(address)"))
 	OperatorRemovedSignature = crypto.Keccak256Hash([]byte("OperatorRemoved(address)"))
+
+	registerTypedParser("WhizyPredictionMarket", BetPlacedSignature, parseBetPlaced)
+	registerTypedParser("WhizyPredictionMarket", MarketCreatedSignature, parseMarketCreated)
+	registerTypedParser("WhizyPredictionMarket", MarketResolvedSignature, parseMarketResolved)
+	registerTypedParser("WhizyPredictionMarket", WinningsClaimedSignature, parseWinningsClaimed)
+	registerTypedParser("WhizyPredictionMarket", MarketVaultRebalancedSignature, parseMarketVaultRebalanced)
+	registerTypedParser("WhizyPredictionMarket", BatchRebalancedSignature, parseBatchRebalanced)
+
+	registerTypedParser("ProtocolSelector", AutoDepositExecutedSignature, parseAutoDepositExecuted)
+	registerTypedParser("ProtocolSelector", AutoWithdrawExecutedSignature, parseAutoWithdrawExecuted)
+	registerTypedParser("ProtocolSelector", OwnershipTransferredSignature, parseOwnershipTransferred)
+	registerTypedParser("ProtocolSelector", PausedSignature, parsePaused)
+	registerTypedParser("ProtocolSelector", ProtocolRegisteredSignature, parseProtocolRegistered)
+	registerTypedParser("ProtocolSelector", ProtocolUpdatedSignature, parseProtocolUpdated)
+	registerTypedParser("ProtocolSelector", UnpausedSignature, parseUnpaused)
+	RegisterVersionedParser("ProtocolSelector", ProtocolSelectorV1, ProtocolRegisteredSignature,
+		func(log types.Log, id string, blockNumber, blockTimestamp config.BigInt, txHash string) (interface{}, error) {
+			entity, err := parseProtocolRegisteredV1(log, id, blockNumber, blockTimestamp, txHash)
+			if err != nil {
+				return nil, err
+			}
+			return entity, nil
+		})
+
+	registerTypedParser("RebalancerDelegation", AutoRebalanceEnabledSignature, parseAutoRebalanceEnabled)
+	registerTypedParser("RebalancerDelegation", AutoRebalanceDisabledSignature, parseAutoRebalanceDisabled)
+	registerTypedParser("RebalancerDelegation", DepositedSignature, parseDeposited)
+	registerTypedParser("RebalancerDelegation", WithdrawnSignature, parseWithdrawn)
+	registerTypedParser("RebalancerDelegation", RebalancedSignature, parseRebalanced)
+	registerTypedParser("RebalancerDelegation", OperatorAddedSignature, parseOperatorAdded)
+	registerTypedParser("RebalancerDelegation", OperatorRemovedSignature, parseOperatorRemoved)
+}
+
+type ParseFunc func(log types.Log, id string, blockNumber, blockTimestamp config.BigInt, txHash string) (interface{}, error)
+
+var parsers = make(map[string]map[string]map[common.Hash]ParseFunc)
+
+func RegisterParser(contractName string, signature common.Hash, fn ParseFunc) {
+	RegisterVersionedParser(contractName, "", signature, fn)
+}
+
+func RegisterVersionedParser(contractName, version string, signature common.Hash, fn ParseFunc) {
+	if parsers[contractName] == nil {
+		parsers[contractName] = make(map[string]map[common.Hash]ParseFunc)
+	}
+	if parsers[contractName][version] == nil {
+		parsers[contractName][version] = make(map[common.Hash]ParseFunc)
+	}
+	parsers[contractName][version][signature] = fn
+}
+
+func lookupParser(contract config.Contract, blockNumber uint64, signature common.Hash) (ParseFunc, bool) {
+	versions := parsers[contract.Name]
+	if version := contract.ABIVersionAt(blockNumber); version != "" {
+		if parse, ok := versions[version][signature]; ok {
+			return parse, true
+		}
+	}
+	parse, ok := versions[""][signature]
+	return parse, ok
+}
+
+var eventSignatures = make(map[string]map[string]common.Hash)
+
+func registerTypedParser[T any](contractName string, signature common.Hash, fn func(types.Log, string, config.BigInt, config.BigInt, string) (*T, error)) {
+	if eventSignatures[contractName] == nil {
+		eventSignatures[contractName] = make(map[string]common.Hash)
+	}
+	eventSignatures[contractName][reflect.TypeOf((*T)(nil)).Elem().Name()] = signature
+
+	RegisterParser(contractName, signature, func(log types.Log, id string, blockNumber, blockTimestamp config.BigInt, txHash string) (interface{}, error) {
+		entity, err := fn(log, id, blockNumber, blockTimestamp, txHash)
+		if err != nil {
+			return nil, err
+		}
+		return entity, nil
+	})
+}
+
+func HasParser(contractName string) bool {
+	return len(parsers[contractName]) > 0
 }
 
 func ParseLog(log types.Log, contractAddress string, blockTimestamp uint64) (interface{}, error) {
-	if len(log.Topics) == 0 {
-		return nil, fmt.Errorf("log has no topics")
+	contract, ok := contractByAddress(contractAddress)
+	if !ok {
+		return nil, fmt.Errorf("unknown contract %s", contractAddress)
+	}
+	return ParseContractLog(contract, log, blockTimestamp)
+}
+
+func DecodeLog(log types.Log) (interface{}, string, error) {
+	contract, ok := contractByAddress(log.Address.Hex())
+	if !ok {
+		return nil, "", fmt.Errorf("unknown contract %s", log.Address.Hex())
+	}
+	entity, err := ParseContractLog(contract, log, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	return entity, eventTypeName(entity), nil
+}
+
+func ParseContractLog(contract config.Contract, log types.Log, blockTimestamp uint64) (interface{}, error) {
+	if len(log.Topics) == 0 && !hasAnonymousParsers(contract.Name) {
+		return nil, fmt.Errorf("%w: %d data bytes for contract %s", ErrAnonymousEvent, len(log.Data), contract.Address)
 	}
 
-	eventSig := log.Topics[0]
 	txHash := log.TxHash.Hex()
 	blockNumber := config.BigInt{Int: new(big.Int).SetUint64(log.BlockNumber)}
 	blockTS := config.BigInt{Int: new(big.Int).SetUint64(blockTimestamp)}
 
-	id := fmt.Sprintf("%s-%d", txHash, log.Index)
-
-	if strings.EqualFold(contractAddress, config.WhizyPredictionMarketContract.Address) {
-		switch {
-		case eventSig == BetPlacedSignature:
-			return parseBetPlaced(log, id, blockNumber, blockTS, txHash)
-		case eventSig == MarketCreatedSignature:
-			return parseMarketCreated(log, id, blockNumber, blockTS, txHash)
-		case eventSig == MarketResolvedSignature:
-			return parseMarketResolved(log, id, blockNumber, blockTS, txHash)
-		case eventSig == WinningsClaimedSignature:
-			return parseWinningsClaimed(log, id, blockNumber, blockTS, txHash)
-		case eventSig == MarketVaultRebalancedSignature:
-			return parseMarketVaultRebalanced(log, id, blockNumber, blockTS, txHash)
+	id := config.FormatEventID(contract.ChainID, txHash, log.Index)
+
+	if len(log.Topics) > 0 {
+		if parse, ok := lookupParser(contract, log.BlockNumber, log.Topics[0]); ok {
+			entity, err := parse(log, id, blockNumber, blockTS, txHash)
+			if err == nil {
+				err = applyDataLayout(contract, log, entity)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrMalformedLog, err)
+			}
+			return entity, nil
+		}
+		if !hasAnonymousParsers(contract.Name) {
+			return nil, fmt.Errorf("%w: %s for contract %s", ErrUnknownSignature, log.Topics[0].Hex(), contract.Address)
 		}
 	}
 
-	if strings.EqualFold(contractAddress, config.ProtocolSelectorContract.Address) {
-		switch {
-		case eventSig == AutoDepositExecutedSignature:
-			return parseAutoDepositExecuted(log, id, blockNumber, blockTS, txHash)
-		case eventSig == AutoWithdrawExecutedSignature:
-			return parseAutoWithdrawExecuted(log, id, blockNumber, blockTS, txHash)
-		case eventSig == OwnershipTransferredSignature:
-			return parseOwnershipTransferred(log, id, blockNumber, blockTS, txHash)
-		case eventSig == PausedSignature:
-			return parsePaused(log, id, blockNumber, blockTS, txHash)
-		case eventSig == ProtocolRegisteredSignature:
-			return parseProtocolRegistered(log, id, blockNumber, blockTS, txHash)
-		case eventSig == ProtocolUpdatedSignature:
-			return parseProtocolUpdated(log, id, blockNumber, blockTS, txHash)
-		case eventSig == UnpausedSignature:
-			return parseUnpaused(log, id, blockNumber, blockTS, txHash)
-		}
+	parse, err := lookupAnonymousParser(contract, log)
+	if err != nil {
+		return nil, err
+	}
+	entity, err := parse(log, id, blockNumber, blockTS, txHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedLog, err)
 	}
+	return entity, nil
+}
 
-	if strings.EqualFold(contractAddress, config.RebalancerDelegationContract.Address) {
-		switch {
-		case eventSig == AutoRebalanceEnabledSignature:
-			return parseAutoRebalanceEnabled(log, id, blockNumber, blockTS, txHash)
-		case eventSig == AutoRebalanceDisabledSignature:
-			return parseAutoRebalanceDisabled(log, id, blockNumber, blockTS, txHash)
-		case eventSig == DepositedSignature:
-			return parseDeposited(log, id, blockNumber, blockTS, txHash)
-		case eventSig == WithdrawnSignature:
-			return parseWithdrawn(log, id, blockNumber, blockTS, txHash)
-		case eventSig == RebalancedSignature:
-			return parseRebalanced(log, id, blockNumber, blockTS, txHash)
-		case eventSig == OperatorAddedSignature:
-			return parseOperatorAdded(log, id, blockNumber, blockTS, txHash)
-		case eventSig == OperatorRemovedSignature:
-			return parseOperatorRemoved(log, id, blockNumber, blockTS, txHash)
-		}
+func NewRawEvent(log types.Log, contract config.Contract, blockTimestamp uint64) *config.RawEvent {
+	topics := make([]string, len(log.Topics))
+	for i, topic := range log.Topics {
+		topics[i] = topic.Hex()
 	}
 
-	return nil, fmt.Errorf("unknown event signature: %s for contract %s", eventSig.Hex(), contractAddress)
+	txHash := log.TxHash.Hex()
+	return &config.RawEvent{
+		ID:              config.FormatEventID(contract.ChainID, txHash, log.Index),
+		ContractAddress: contract.Address,
+		Topics:          strings.Join(topics, ","),
+		Data:            hexutil.Encode(log.Data),
+		BlockNumber:     config.BigInt{Int: new(big.Int).SetUint64(log.BlockNumber)},
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
+		BlockTimestamp:  config.BigInt{Int: new(big.Int).SetUint64(blockTimestamp)},
+		TransactionHash: txHash,
+	}
 }
 
 func parseBetPlaced(log types.Log, id string, blockNumber, blockTimestamp config.BigInt, txHash string) (*config.BetPlaced, error) {
@@ -133,17 +238,29 @@ func parseBetPlaced(log types.Log, id string, blockNumber, blockTimestamp config
 		return nil, fmt.Errorf("insufficient topics for BetPlaced")
 	}
 
+	marketID, err := topicToUint(log, 1, 256)
+	if err != nil {
+		return nil, fmt.Errorf("invalid market id for BetPlaced: %w", err)
+	}
+
+	user, err := topicToAddress(log, 2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user for BetPlaced: %w", err)
+	}
+
 	entity := &config.BetPlaced{
 		ID:              id,
-		MarketID:        config.BigInt{Int: new(big.Int).SetBytes(log.Topics[1].Bytes())},
-		User:            common.BytesToAddress(log.Topics[2].Bytes()).Hex(),
+		MarketID:        config.BigInt{Int: marketID},
+		User:            user,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
 
 	if len(log.Data) >= 96 {
-		entity.Position = new(big.Int).SetBytes(log.Data[0:32]).Cmp(big.NewInt(0)) != 0
+		entity.Position = !wordIsZero(log.Data[0:32])
 		entity.Amount = config.BigInt{Int: new(big.Int).SetBytes(log.Data[32:64])}
 		entity.Shares = config.BigInt{Int: new(big.Int).SetBytes(log.Data[64:96])}
 	}
@@ -156,25 +273,29 @@ func parseMarketCreated(log types.Log, id string, blockNumber, blockTimestamp co
 		return nil, fmt.Errorf("insufficient topics for MarketCreated")
 	}
 
+	marketID, err := topicToUint(log, 1, 256)
+	if err != nil {
+		return nil, fmt.Errorf("invalid market id for MarketCreated: %w", err)
+	}
+
 	entity := &config.MarketCreated{
 		ID:              id,
-		MarketID:        config.BigInt{Int: new(big.Int).SetBytes(log.Topics[1].Bytes())},
+		MarketID:        config.BigInt{Int: marketID},
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
 
 	if len(log.Data) >= 128 {
-		offset := new(big.Int).SetBytes(log.Data[0:32]).Uint64()
+		offset := wordToUint64(log.Data[0:32])
 		entity.EndTime = config.BigInt{Int: new(big.Int).SetBytes(log.Data[32:64])}
-		entity.TokenAddress = common.BytesToAddress(log.Data[64:96]).Hex()
-		entity.VaultAddress = common.BytesToAddress(log.Data[96:128]).Hex()
+		entity.TokenAddress = addressHex(log.Data[64:96])
+		entity.VaultAddress = addressHex(log.Data[96:128])
 
-		if uint64(len(log.Data)) > offset+32 {
-			strLen := new(big.Int).SetBytes(log.Data[offset : offset+32]).Uint64()
-			if uint64(len(log.Data)) >= offset+32+strLen {
-				entity.Question = string(log.Data[offset+32 : offset+32+strLen])
-			}
+		if str, ok := decodeDynamicBytes(log.Data, offset); ok {
+			entity.Question = string(str)
 		}
 	}
 
@@ -186,16 +307,23 @@ func parseMarketResolved(log types.Log, id string, blockNumber, blockTimestamp c
 		return nil, fmt.Errorf("insufficient topics for MarketResolved")
 	}
 
+	marketID, err := topicToUint(log, 1, 256)
+	if err != nil {
+		return nil, fmt.Errorf("invalid market id for MarketResolved: %w", err)
+	}
+
 	entity := &config.MarketResolved{
 		ID:              id,
-		MarketID:        config.BigInt{Int: new(big.Int).SetBytes(log.Topics[1].Bytes())},
+		MarketID:        config.BigInt{Int: marketID},
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
 
 	if len(log.Data) >= 32 {
-		entity.Outcome = new(big.Int).SetBytes(log.Data[0:32]).Cmp(big.NewInt(0)) != 0
+		entity.Outcome = !wordIsZero(log.Data[0:32])
 	}
 
 	return entity, nil
@@ -206,11 +334,23 @@ func parseWinningsClaimed(log types.Log, id string, blockNumber, blockTimestamp
 		return nil, fmt.Errorf("insufficient topics for WinningsClaimed")
 	}
 
+	marketID, err := topicToUint(log, 1, 256)
+	if err != nil {
+		return nil, fmt.Errorf("invalid market id for WinningsClaimed: %w", err)
+	}
+
+	user, err := topicToAddress(log, 2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user for WinningsClaimed: %w", err)
+	}
+
 	entity := &config.WinningsClaimed{
 		ID:              id,
-		MarketID:        config.BigInt{Int: new(big.Int).SetBytes(log.Topics[1].Bytes())},
-		User:            common.BytesToAddress(log.Topics[2].Bytes()).Hex(),
+		MarketID:        config.BigInt{Int: marketID},
+		User:            user,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
@@ -227,18 +367,30 @@ func parseAutoDepositExecuted(log types.Log, id string, blockNumber, blockTimest
 		return nil, fmt.Errorf("insufficient topics for AutoDepositExecuted")
 	}
 
+	user, err := topicToAddress(log, 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user for AutoDepositExecuted: %w", err)
+	}
+
+	protocol, err := topicToAddress(log, 2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protocol for AutoDepositExecuted: %w", err)
+	}
+
 	entity := &config.AutoDepositExecuted{
 		ID:              id,
-		User:            common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
-		Protocol:        common.BytesToAddress(log.Topics[2].Bytes()).Hex(),
+		User:            user,
+		Protocol:        protocol,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
 
 	if len(log.Data) >= 64 {
 		entity.Amount = config.BigInt{Int: new(big.Int).SetBytes(log.Data[0:32])}
-		entity.Success = new(big.Int).SetBytes(log.Data[32:64]).Cmp(big.NewInt(0)) != 0
+		entity.Success = !wordIsZero(log.Data[32:64])
 	}
 
 	return entity, nil
@@ -249,18 +401,30 @@ func parseAutoWithdrawExecuted(log types.Log, id string, blockNumber, blockTimes
 		return nil, fmt.Errorf("insufficient topics for AutoWithdrawExecuted")
 	}
 
+	user, err := topicToAddress(log, 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user for AutoWithdrawExecuted: %w", err)
+	}
+
+	protocol, err := topicToAddress(log, 2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protocol for AutoWithdrawExecuted: %w", err)
+	}
+
 	entity := &config.AutoWithdrawExecuted{
 		ID:              id,
-		User:            common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
-		Protocol:        common.BytesToAddress(log.Topics[2].Bytes()).Hex(),
+		User:            user,
+		Protocol:        protocol,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
 
 	if len(log.Data) >= 64 {
 		entity.Amount = config.BigInt{Int: new(big.Int).SetBytes(log.Data[0:32])}
-		entity.Success = new(big.Int).SetBytes(log.Data[32:64]).Cmp(big.NewInt(0)) != 0
+		entity.Success = !wordIsZero(log.Data[32:64])
 	}
 
 	return entity, nil
@@ -271,11 +435,23 @@ func parseOwnershipTransferred(log types.Log, id string, blockNumber, blockTimes
 		return nil, fmt.Errorf("insufficient topics for OwnershipTransferred")
 	}
 
+	previousOwner, err := topicToAddress(log, 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid previous owner for OwnershipTransferred: %w", err)
+	}
+
+	newOwner, err := topicToAddress(log, 2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid new owner for OwnershipTransferred: %w", err)
+	}
+
 	entity := &config.OwnershipTransferred{
 		ID:              id,
-		PreviousOwner:   common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
-		NewOwner:        common.BytesToAddress(log.Topics[2].Bytes()).Hex(),
+		PreviousOwner:   previousOwner,
+		NewOwner:        newOwner,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
@@ -287,12 +463,14 @@ func parsePaused(log types.Log, id string, blockNumber, blockTimestamp config.Bi
 	entity := &config.Paused{
 		ID:              id,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
 
 	if len(log.Data) >= 32 {
-		entity.Account = common.BytesToAddress(log.Data[0:32]).Hex()
+		entity.Account = addressHex(log.Data[0:32])
 	}
 
 	return entity, nil
@@ -303,27 +481,107 @@ func parseProtocolRegistered(log types.Log, id string, blockNumber, blockTimesta
 		return nil, fmt.Errorf("insufficient topics for ProtocolRegistered")
 	}
 
+	protocolType, err := topicToUint(log, 1, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protocol type for ProtocolRegistered: %w", err)
+	}
+
+	protocolAddress, err := topicToAddress(log, 2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protocol address for ProtocolRegistered: %w", err)
+	}
+
 	entity := &config.ProtocolRegistered{
 		ID:              id,
-		ProtocolType:    int(new(big.Int).SetBytes(log.Topics[1].Bytes()).Int64()),
-		ProtocolAddress: common.BytesToAddress(log.Topics[2].Bytes()).Hex(),
+		ProtocolType:    config.ProtocolType(protocolType.Int64()),
+		ProtocolAddress: protocolAddress,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
 
-	if len(log.Data) >= 64 {
-		offset := new(big.Int).SetBytes(log.Data[0:32]).Uint64()
-		entity.RiskLevel = int(new(big.Int).SetBytes(log.Data[32:64]).Int64())
+	if len(log.Topics) >= 4 && len(log.Data) < 64 {
+		if len(log.Data) < 32 {
+			return nil, fmt.Errorf("missing risk level for ProtocolRegistered")
+		}
+		riskLevel, err := decodeUint(log.Data[0:32], 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid risk level for ProtocolRegistered: %w", err)
+		}
+		entity.RiskLevel = config.RiskLevel(riskLevel.Int64())
+		entity.Name = resolveIndexedString(log.Topics[3], config.CFG.KnownProtocolNames)
+		if entity.Name == log.Topics[3].Hex() {
+			fmt.Printf("Warning: ProtocolRegistered %s name is indexed, storing hash %s\n", id, entity.Name)
+		}
+	} else if len(log.Data) >= 64 {
+		offset := wordToUint64(log.Data[0:32])
+		riskLevel, err := decodeUint(log.Data[32:64], 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid risk level for ProtocolRegistered: %w", err)
+		}
+		entity.RiskLevel = config.RiskLevel(riskLevel.Int64())
 
-		if uint64(len(log.Data)) > offset+32 {
-			strLen := new(big.Int).SetBytes(log.Data[offset : offset+32]).Uint64()
-			if uint64(len(log.Data)) >= offset+32+strLen {
-				entity.Name = string(log.Data[offset+32 : offset+32+strLen])
-			}
+		if str, ok := decodeDynamicBytes(log.Data, offset); ok {
+			entity.Name = string(str)
 		}
 	}
 
+	if entity.Name == "" {
+		fmt.Printf("Warning: ProtocolRegistered %s has no decodable name\n", id)
+	}
+	// An out-of-range enum means the layout was misread, so the log is kept in raw_events for reparse instead.
+	if !entity.ProtocolType.IsValid() {
+		return nil, fmt.Errorf("unknown protocol type %d for ProtocolRegistered", entity.ProtocolType)
+	}
+	if !entity.RiskLevel.IsValid() {
+		return nil, fmt.Errorf("unknown risk level %d for ProtocolRegistered", entity.RiskLevel)
+	}
+
+	return entity, nil
+}
+
+// parseProtocolRegisteredV1 decodes the pre-upgrade layout, where every field is in the data:
+// protocolType, protocolAddress, the name offset, riskLevel, then the name.
+func parseProtocolRegisteredV1(log types.Log, id string, blockNumber, blockTimestamp config.BigInt, txHash string) (*config.ProtocolRegistered, error) {
+	if len(log.Data) < 128 {
+		return nil, fmt.Errorf("insufficient data for ProtocolRegistered v1")
+	}
+
+	protocolType, err := decodeUint(log.Data[0:32], 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protocol type for ProtocolRegistered v1: %w", err)
+	}
+	if !wordIsZero(log.Data[32 : 64-common.AddressLength]) {
+		return nil, fmt.Errorf("invalid protocol address for ProtocolRegistered v1: %s", hexutil.Encode(log.Data[32:64]))
+	}
+	riskLevel, err := decodeUint(log.Data[96:128], 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid risk level for ProtocolRegistered v1: %w", err)
+	}
+
+	entity := &config.ProtocolRegistered{
+		ID:              id,
+		ProtocolType:    config.ProtocolType(protocolType.Int64()),
+		ProtocolAddress: addressHex(log.Data[32:64]),
+		RiskLevel:       config.RiskLevel(riskLevel.Int64()),
+		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
+		BlockTimestamp:  blockTimestamp,
+		TransactionHash: txHash,
+	}
+	if str, ok := decodeDynamicBytes(log.Data, wordToUint64(log.Data[64:96])); ok {
+		entity.Name = string(str)
+	}
+
+	if !entity.ProtocolType.IsValid() {
+		return nil, fmt.Errorf("unknown protocol type %d for ProtocolRegistered", entity.ProtocolType)
+	}
+	if !entity.RiskLevel.IsValid() {
+		return nil, fmt.Errorf("unknown risk level %d for ProtocolRegistered", entity.RiskLevel)
+	}
 	return entity, nil
 }
 
@@ -332,10 +590,17 @@ func parseProtocolUpdated(log types.Log, id string, blockNumber, blockTimestamp
 		return nil, fmt.Errorf("insufficient topics for ProtocolUpdated")
 	}
 
+	protocolAddress, err := topicToAddress(log, 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protocol address for ProtocolUpdated: %w", err)
+	}
+
 	entity := &config.ProtocolUpdated{
 		ID:              id,
-		ProtocolAddress: common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
+		ProtocolAddress: protocolAddress,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
@@ -352,12 +617,14 @@ func parseUnpaused(log types.Log, id string, blockNumber, blockTimestamp config.
 	entity := &config.Unpaused{
 		ID:              id,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
 
 	if len(log.Data) >= 32 {
-		entity.Account = common.BytesToAddress(log.Data[0:32]).Hex()
+		entity.Account = addressHex(log.Data[0:32])
 	}
 
 	return entity, nil
@@ -368,30 +635,158 @@ func parseAutoRebalanceEnabled(log types.Log, id string, blockNumber, blockTimes
 		return nil, fmt.Errorf("insufficient topics for AutoRebalanceEnabled")
 	}
 
+	user, err := topicToAddress(log, 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user for AutoRebalanceEnabled: %w", err)
+	}
+
 	entity := &config.AutoRebalanceEnabled{
 		ID:              id,
-		User:            common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
+		User:            user,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
 
-	if len(log.Data) >= 32 {
-		entity.RiskProfile = int(new(big.Int).SetBytes(log.Data[0:32]).Int64())
+	var riskProfile int
+	switch {
+	case len(log.Topics) >= 3:
+		value, err := topicToUint(log, 2, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid risk profile for AutoRebalanceEnabled: %w", err)
+		}
+		riskProfile = int(value.Int64())
+	case len(log.Data) >= 32:
+		value, err := decodeUint(log.Data[0:32], 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid risk profile for AutoRebalanceEnabled: %w", err)
+		}
+		riskProfile = int(value.Int64())
+	default:
+		return nil, fmt.Errorf("missing risk profile for AutoRebalanceEnabled")
+	}
+	entity.RiskProfile = config.RiskProfile(riskProfile)
+	if !entity.RiskProfile.IsValid() {
+		fmt.Printf("Warning: AutoRebalanceEnabled %s has unknown risk profile %d\n", id, riskProfile)
 	}
 
 	return entity, nil
 }
 
+func topicWord(log types.Log, index int) ([]byte, error) {
+	if index >= len(log.Topics) {
+		return nil, fmt.Errorf("missing topic %d, log has %d", index, len(log.Topics))
+	}
+	return log.Topics[index].Bytes(), nil
+}
+
+func topicToAddress(log types.Log, index int) (string, error) {
+	word, err := topicWord(log, index)
+	if err != nil {
+		return "", err
+	}
+	for _, b := range word[:common.HashLength-common.AddressLength] {
+		if b != 0 {
+			return "", fmt.Errorf("topic %d is not an address: %s", index, hexutil.Encode(word))
+		}
+	}
+	return addressHex(word), nil
+}
+
+func topicToUint(log types.Log, index int, bits int) (*big.Int, error) {
+	word, err := topicWord(log, index)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decodeUint(word, bits)
+	if err != nil {
+		return nil, fmt.Errorf("topic %d: %w", index, err)
+	}
+	return value, nil
+}
+
+// decodeUint reads a 32-byte word, from a topic or the data, as an unsigned integer of at most bits bits.
+func decodeUint(word []byte, bits int) (*big.Int, error) {
+	if len(word) != 32 {
+		return nil, fmt.Errorf("expected 32-byte word, got %d bytes", len(word))
+	}
+	value := new(big.Int).SetBytes(word)
+	if value.BitLen() > bits {
+		return nil, fmt.Errorf("value %s overflows uint%d", value.String(), bits)
+	}
+	return value, nil
+}
+
+func addressHex(b []byte) string {
+	// Same result as lowercasing common.Address.Hex(), without computing the EIP-55 checksum.
+	if len(b) > common.AddressLength {
+		b = b[len(b)-common.AddressLength:]
+	}
+	return hexutil.Encode(common.LeftPadBytes(b, common.AddressLength))
+}
+
+func wordIsZero(word []byte) bool {
+	for _, b := range word {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeDynamicBytes reads the length-prefixed bytes at offset, with bounds checks that can't overflow.
+func decodeDynamicBytes(data []byte, offset uint64) ([]byte, bool) {
+	size := uint64(len(data))
+	if size < 32 || offset >= size-32 {
+		return nil, false
+	}
+	start := offset + 32
+	length := wordToUint64(data[offset:start])
+	if length > size-start {
+		return nil, false
+	}
+	return data[start : start+length], true
+}
+
+func wordToUint64(word []byte) uint64 {
+	// Keeps the low 64 bits, like big.Int.Uint64, without allocating.
+	if len(word) > 8 {
+		word = word[len(word)-8:]
+	}
+	var v uint64
+	for _, b := range word {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func resolveIndexedString(topic common.Hash, candidates []string) string {
+	for _, candidate := range candidates {
+		if crypto.Keccak256Hash([]byte(candidate)) == topic {
+			return candidate
+		}
+	}
+	return topic.Hex()
+}
+
 func parseAutoRebalanceDisabled(log types.Log, id string, blockNumber, blockTimestamp config.BigInt, txHash string) (*config.AutoRebalanceDisabled, error) {
 	if len(log.Topics) < 2 {
 		return nil, fmt.Errorf("insufficient topics for AutoRebalanceDisabled")
 	}
 
+	user, err := topicToAddress(log, 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user for AutoRebalanceDisabled: %w", err)
+	}
+
 	return &config.AutoRebalanceDisabled{
 		ID:              id,
-		User:            common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
+		User:            user,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}, nil
@@ -402,10 +797,17 @@ func parseDeposited(log types.Log, id string, blockNumber, blockTimestamp config
 		return nil, fmt.Errorf("insufficient topics for Deposited")
 	}
 
+	user, err := topicToAddress(log, 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user for Deposited: %w", err)
+	}
+
 	entity := &config.Deposited{
 		ID:              id,
-		User:            common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
+		User:            user,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
@@ -422,10 +824,17 @@ func parseWithdrawn(log types.Log, id string, blockNumber, blockTimestamp config
 		return nil, fmt.Errorf("insufficient topics for Withdrawn")
 	}
 
+	user, err := topicToAddress(log, 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user for Withdrawn: %w", err)
+	}
+
 	entity := &config.Withdrawn{
 		ID:              id,
-		User:            common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
+		User:            user,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
@@ -442,11 +851,23 @@ func parseRebalanced(log types.Log, id string, blockNumber, blockTimestamp confi
 		return nil, fmt.Errorf("insufficient topics for Rebalanced")
 	}
 
+	user, err := topicToAddress(log, 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user for Rebalanced: %w", err)
+	}
+
+	operator, err := topicToAddress(log, 2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid operator for Rebalanced: %w", err)
+	}
+
 	entity := &config.Rebalanced{
 		ID:              id,
-		User:            common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
-		Operator:        common.BytesToAddress(log.Topics[2].Bytes()).Hex(),
+		User:            user,
+		Operator:        operator,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
@@ -463,10 +884,17 @@ func parseOperatorAdded(log types.Log, id string, blockNumber, blockTimestamp co
 		return nil, fmt.Errorf("insufficient topics for OperatorAdded")
 	}
 
+	operator, err := topicToAddress(log, 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid operator for OperatorAdded: %w", err)
+	}
+
 	return &config.OperatorAdded{
 		ID:              id,
-		Operator:        common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
+		Operator:        operator,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}, nil
@@ -477,10 +905,17 @@ func parseOperatorRemoved(log types.Log, id string, blockNumber, blockTimestamp
 		return nil, fmt.Errorf("insufficient topics for OperatorRemoved")
 	}
 
+	operator, err := topicToAddress(log, 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid operator for OperatorRemoved: %w", err)
+	}
+
 	return &config.OperatorRemoved{
 		ID:              id,
-		Operator:        common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
+		Operator:        operator,
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}, nil
@@ -491,10 +926,17 @@ func parseMarketVaultRebalanced(log types.Log, id string, blockNumber, blockTime
 		return nil, fmt.Errorf("insufficient topics for MarketVaultRebalanced")
 	}
 
+	marketID, err := topicToUint(log, 1, 256)
+	if err != nil {
+		return nil, fmt.Errorf("invalid market id for MarketVaultRebalanced: %w", err)
+	}
+
 	entity := &config.MarketVaultRebalanced{
 		ID:              id,
-		MarketID:        config.BigInt{Int: new(big.Int).SetBytes(log.Topics[1].Bytes())},
+		MarketID:        config.BigInt{Int: marketID},
 		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
 		BlockTimestamp:  blockTimestamp,
 		TransactionHash: txHash,
 	}
@@ -505,3 +947,65 @@ func parseMarketVaultRebalanced(log types.Log, id string, blockNumber, blockTime
 
 	return entity, nil
 }
+
+func parseBatchRebalanced(log types.Log, id string, blockNumber, blockTimestamp config.BigInt, txHash string) (*config.BatchRebalanced, error) {
+	if len(log.Data) < 64 {
+		return nil, fmt.Errorf("insufficient data for BatchRebalanced")
+	}
+
+	marketIDs, err := decodeUint256Array(log.Data, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid market ids for BatchRebalanced: %w", err)
+	}
+	amounts, err := decodeUint256Array(log.Data, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amounts for BatchRebalanced: %w", err)
+	}
+	if len(marketIDs) != len(amounts) {
+		return nil, fmt.Errorf("BatchRebalanced has %d market ids but %d amounts", len(marketIDs), len(amounts))
+	}
+
+	principals := make(config.Principals, len(marketIDs))
+	for i := range marketIDs {
+		// A market listed twice keeps the sum of its amounts.
+		key := marketIDs[i].String()
+		if prev, ok := principals[key]; ok {
+			amounts[i].Add(amounts[i], prev.Int)
+		}
+		principals[key] = config.BigInt{Int: amounts[i]}
+	}
+
+	return &config.BatchRebalanced{
+		ID:              id,
+		Principals:      principals,
+		BlockNumber:     blockNumber,
+		LogIndex:        log.Index,
+		BlockHash:       log.BlockHash.Hex(),
+		BlockTimestamp:  blockTimestamp,
+		TransactionHash: txHash,
+	}, nil
+}
+
+func decodeUint256Array(data []byte, head int) ([]*big.Int, error) {
+	if len(data) < head+32 {
+		return nil, fmt.Errorf("missing offset at %d", head)
+	}
+	offset := new(big.Int).SetBytes(data[head : head+32])
+	// Compared against len-32 so a huge offset can't wrap past the bound.
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(data))-32 {
+		return nil, fmt.Errorf("offset %s out of range", offset)
+	}
+	start := offset.Uint64()
+
+	length := new(big.Int).SetBytes(data[start : start+32])
+	if !length.IsUint64() || length.Uint64() > (uint64(len(data))-start-32)/32 {
+		return nil, fmt.Errorf("length %s out of range", length)
+	}
+
+	values := make([]*big.Int, length.Uint64())
+	for i := range values {
+		pos := start + 32 + uint64(i)*32
+		values[i] = new(big.Int).SetBytes(data[pos : pos+32])
+	}
+	return values, nil
+}
@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/evaafi/go-indexer/config"
+)
+
+const benchRangeLogs = 1000
+
+// discardSink keeps nothing, a MemorySink would grow across iterations and count its appends in B/op.
+type discardSink struct{}
+
+func (discardSink) Store(ctx context.Context, contract config.Contract, entities []interface{}) error {
+	return nil
+}
+
+func BenchmarkParseLog(b *testing.B) {
+	for _, contractName := range sortedKeys(eventSignatures) {
+		contract := benchContract(contractName)
+		for _, event := range sortedKeys(eventSignatures[contractName]) {
+			log := benchLog(event, eventSignatures[contractName][event], 0)
+			if _, err := ParseContractLog(contract, log, 1); err != nil {
+				b.Fatalf("synthetic %s log does not parse: %v", event, err)
+			}
+
+			b.Run(event, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					ParseContractLog(contract, log, 1)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkProcessBlockRange(b *testing.B) {
+	contract := benchContract("WhizyPredictionMarket")
+
+	var mixed []types.Log
+	for _, event := range sortedKeys(eventSignatures[contract.Name]) {
+		mixed = append(mixed, benchLog(event, eventSignatures[contract.Name][event], 0))
+	}
+
+	// processLogs is everything processBlockRange does after the RPC fetch, which is what the benchmark isolates.
+	logs := make([]types.Log, benchRangeLogs)
+	rpcClient := &RPCClient{timestamps: newTimestampCache(benchRangeLogs)}
+	for i := range logs {
+		logs[i] = mixed[i%len(mixed)]
+		logs[i].BlockNumber = uint64(i / 10)
+		logs[i].Index = uint(i % 10)
+		rpcClient.timestamps.Add(logs[i].BlockNumber, 1)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := processLogs(context.Background(), discardSink{}, rpcClient, contract, 0, uint64(benchRangeLogs/10), logs, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchContract(name string) config.Contract {
+	return config.Contract{Name: name, Address: common.BigToAddress(big.NewInt(1)).Hex()}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func benchLog(event string, signature common.Hash, index uint) types.Log {
+	// The data is both a valid string head (offset 0x80) and valid for fixed-width fields, so every parser accepts it.
+	word := func(v int64) []byte {
+		return common.BigToHash(big.NewInt(v)).Bytes()
+	}
+
+	var data []byte
+	if event == "BatchRebalanced" {
+		for _, v := range []int64{0x40, 0xa0, 2, 1, 2, 2, 100, 200} {
+			data = append(data, word(v)...)
+		}
+	} else {
+		for _, v := range []int64{0x80, 1, 1, 1, 16} {
+			data = append(data, word(v)...)
+		}
+		data = append(data, common.RightPadBytes([]byte("benchmark market"), 32)...)
+	}
+
+	one := common.BigToHash(big.NewInt(1))
+	return types.Log{
+		Address: common.BigToAddress(big.NewInt(1)),
+		Topics:  []common.Hash{signature, one, one, one},
+		Data:    data,
+		TxHash:  common.BigToHash(big.NewInt(2)),
+		Index:   index,
+	}
+}
@@ -0,0 +1,354 @@
+package indexer
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/evaafi/go-indexer/config"
+)
+
+const protocolRegisteredABI = `[{"type":"event","name":"ProtocolRegistered","anonymous":false,"inputs":[
+	{"name":"protocolType","type":"uint8","indexed":true},
+	{"name":"protocolAddress","type":"address","indexed":true},
+	{"name":"name","type":"string","indexed":false},
+	{"name":"riskLevel","type":"uint8","indexed":false}]}]`
+
+var protocolAddress = common.HexToAddress("0x00000000000000000000000000000000000000Cc")
+
+func protocolRegisteredLog(t *testing.T, protocolType int64, name string, riskLevel uint8) types.Log {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(protocolRegisteredABI))
+	if err != nil {
+		t.Fatalf("parse abi: %v", err)
+	}
+	event := parsed.Events["ProtocolRegistered"]
+	if event.ID != ProtocolRegisteredSignature {
+		t.Fatalf("abi signature %s does not match %s", event.ID, ProtocolRegisteredSignature)
+	}
+	data, err := event.Inputs.NonIndexed().Pack(name, riskLevel)
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	return types.Log{
+		Address: common.BigToAddress(big.NewInt(1)),
+		Topics:  []common.Hash{event.ID, common.BigToHash(big.NewInt(protocolType)), common.BytesToHash(protocolAddress.Bytes())},
+		Data:    data,
+		TxHash:  common.BigToHash(big.NewInt(2)),
+	}
+}
+
+func TestParseProtocolRegisteredEnums(t *testing.T) {
+	contract := benchContract("ProtocolSelector")
+
+	overflowRisk := protocolRegisteredLog(t, 0, "Aave", 0)
+	overflowRisk.Data[32+30] = 1
+
+	tests := []struct {
+		name         string
+		log          types.Log
+		protocolType config.ProtocolType
+		riskLevel    config.RiskLevel
+		wantErr      string
+	}{
+		{"lending low", protocolRegisteredLog(t, 0, "Aave", 0), config.ProtocolTypeLending, config.RiskLevelLow, ""},
+		{"liquidity high", protocolRegisteredLog(t, 2, "Uniswap", 2), config.ProtocolTypeLiquidity, config.RiskLevelHigh, ""},
+		{"unknown protocol type", protocolRegisteredLog(t, 3, "Aave", 0), 0, 0, "unknown protocol type 3"},
+		{"protocol type overflows uint8", protocolRegisteredLog(t, 256, "Aave", 0), 0, 0, "invalid protocol type"},
+		{"unknown risk level", protocolRegisteredLog(t, 1, "Lido", 7), 0, 0, "unknown risk level 7"},
+		{"risk level overflows uint8", overflowRisk, 0, 0, "overflows uint8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entity, err := ParseContractLog(contract, tt.log, 1)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrMalformedLog) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want a malformed log error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			protocol := entity.(*config.ProtocolRegistered)
+			if protocol.ProtocolType != tt.protocolType || protocol.RiskLevel != tt.riskLevel {
+				t.Errorf("got type %s risk %s, want %s and %s", protocol.ProtocolType, protocol.RiskLevel, tt.protocolType, tt.riskLevel)
+			}
+		})
+	}
+}
+
+func TestParseProtocolRegisteredNameEncodings(t *testing.T) {
+	saved := config.CFG
+	defer func() { config.CFG = saved }()
+	config.CFG.KnownProtocolNames = []string{"Compound", "Aave"}
+
+	contract := benchContract("ProtocolSelector")
+
+	// Some deployments declare the name as indexed, so only its hash is in the topics and data holds the risk level.
+	indexed := func(name string) types.Log {
+		log := protocolRegisteredLog(t, 1, "", 2)
+		log.Topics = append(log.Topics, crypto.Keccak256Hash([]byte(name)))
+		log.Data = common.BigToHash(big.NewInt(2)).Bytes()
+		return log
+	}
+
+	tests := []struct {
+		name string
+		log  types.Log
+		want string
+	}{
+		{"name in data", protocolRegisteredLog(t, 1, "Lido Staking", 2), "Lido Staking"},
+		{"indexed known name", indexed("Aave"), "Aave"},
+		{"indexed unknown name", indexed("Morpho"), crypto.Keccak256Hash([]byte("Morpho")).Hex()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entity, err := ParseContractLog(contract, tt.log, 1)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			protocol := entity.(*config.ProtocolRegistered)
+			if protocol.Name != tt.want {
+				t.Errorf("name %q, want %q", protocol.Name, tt.want)
+			}
+			if protocol.ProtocolType != config.ProtocolTypeStaking || protocol.RiskLevel != config.RiskLevelHigh {
+				t.Errorf("got type %s risk %s, want staking and high", protocol.ProtocolType, protocol.RiskLevel)
+			}
+			if protocol.ProtocolAddress != addressHex(protocolAddress.Bytes()) {
+				t.Errorf("protocol address %s", protocol.ProtocolAddress)
+			}
+		})
+	}
+}
+
+func TestAddressHexStoresLowercase(t *testing.T) {
+	checksummed := common.HexToAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed")
+	want := "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"20-byte address", checksummed.Bytes(), want},
+		{"32-byte topic word", common.BytesToHash(checksummed.Bytes()).Bytes(), want},
+		{"short value", []byte{0xAB}, "0x00000000000000000000000000000000000000ab"},
+		{"zero address", make([]byte, 32), "0x0000000000000000000000000000000000000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := addressHex(tt.input)
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if got != strings.ToLower(common.BytesToAddress(tt.input).Hex()) {
+				t.Errorf("%s differs from the lowercased checksummed address", got)
+			}
+		})
+	}
+
+	// Decoded events carry the same format, so lookups only need to lowercase the address.
+	log := protocolRegisteredLog(t, 0, "Aave", 0)
+	log.Topics[2] = common.BytesToHash(checksummed.Bytes())
+	entity, err := ParseContractLog(benchContract("ProtocolSelector"), log, 1)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := entity.(*config.ProtocolRegistered).ProtocolAddress; got != want {
+		t.Errorf("stored protocol address %s, want %s", got, want)
+	}
+}
+
+func TestParseAutoRebalanceEvents(t *testing.T) {
+	contract := benchContract("RebalancerDelegation")
+	user := common.HexToAddress("0x00000000000000000000000000000000000000Dd")
+	userTopic := common.BytesToHash(user.Bytes())
+
+	uint8Args := abi.Arguments{{Type: abi.Type{T: abi.UintTy, Size: 8}}}
+	profileData := func(profile uint8) []byte {
+		data, err := uint8Args.Pack(profile)
+		if err != nil {
+			t.Fatalf("pack: %v", err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		log     types.Log
+		want    interface{}
+		wantErr string
+	}{
+		{
+			"enabled with profile in data",
+			types.Log{Topics: []common.Hash{AutoRebalanceEnabledSignature, userTopic}, Data: profileData(1)},
+			&config.AutoRebalanceEnabled{User: addressHex(user.Bytes()), RiskProfile: config.RiskProfileModerate},
+			"",
+		},
+		{
+			"enabled with indexed profile",
+			types.Log{Topics: []common.Hash{AutoRebalanceEnabledSignature, userTopic, common.BigToHash(big.NewInt(2))}},
+			&config.AutoRebalanceEnabled{User: addressHex(user.Bytes()), RiskProfile: config.RiskProfileAggressive},
+			"",
+		},
+		{
+			// Unknown profiles are stored with a warning rather than rejected.
+			"enabled with unknown profile",
+			types.Log{Topics: []common.Hash{AutoRebalanceEnabledSignature, userTopic}, Data: profileData(9)},
+			&config.AutoRebalanceEnabled{User: addressHex(user.Bytes()), RiskProfile: config.RiskProfile(9)},
+			"",
+		},
+		{
+			"enabled without profile",
+			types.Log{Topics: []common.Hash{AutoRebalanceEnabledSignature, userTopic}},
+			nil,
+			"missing risk profile",
+		},
+		{
+			"disabled",
+			types.Log{Topics: []common.Hash{AutoRebalanceDisabledSignature, userTopic}},
+			&config.AutoRebalanceDisabled{User: addressHex(user.Bytes())},
+			"",
+		},
+		{
+			"disabled without user",
+			types.Log{Topics: []common.Hash{AutoRebalanceDisabledSignature}},
+			nil,
+			"insufficient topics",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.log.Address = common.BigToAddress(big.NewInt(1))
+			entity, err := ParseContractLog(contract, tt.log, 1)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrMalformedLog) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want a malformed log error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			switch want := tt.want.(type) {
+			case *config.AutoRebalanceEnabled:
+				got, ok := entity.(*config.AutoRebalanceEnabled)
+				if !ok || got.User != want.User || got.RiskProfile != want.RiskProfile {
+					t.Errorf("got %+v, want user %s profile %d", entity, want.User, want.RiskProfile)
+				}
+			case *config.AutoRebalanceDisabled:
+				got, ok := entity.(*config.AutoRebalanceDisabled)
+				if !ok || got.User != want.User {
+					t.Errorf("got %+v, want user %s", entity, want.User)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRejectsWrappingOffsets(t *testing.T) {
+	// An offset of 2^64-16 wraps to 16 once 32 is added, which used to slice past the data.
+	wrapping := make([]byte, 32)
+	new(big.Int).SetUint64(^uint64(0) - 15).FillBytes(wrapping)
+
+	marketCreated := types.Log{
+		Topics: []common.Hash{MarketCreatedSignature, common.BigToHash(big.NewInt(1))},
+		Data:   append(append([]byte{}, wrapping...), make([]byte, 96)...),
+	}
+	market, err := parseMarketCreated(marketCreated, "m", config.NewBigInt(1), config.NewBigInt(1), "0x01")
+	if err != nil || market.Question != "" {
+		t.Errorf("MarketCreated: got question %q, err %v", market.Question, err)
+	}
+
+	protocolRegistered := protocolRegisteredLog(t, 1, "Lido", 2)
+	copy(protocolRegistered.Data[0:32], wrapping)
+	protocol, err := parseProtocolRegistered(protocolRegistered, "p", config.NewBigInt(1), config.NewBigInt(1), "0x01")
+	if err != nil || protocol.Name != "" {
+		t.Errorf("ProtocolRegistered: got name %q, err %v", protocol.Name, err)
+	}
+
+	batch := append(append([]byte{}, wrapping...), wrapping...)
+	if _, err := parseBatchRebalanced(types.Log{Data: batch}, "b", config.NewBigInt(1), config.NewBigInt(1), "0x01"); err == nil {
+		t.Error("BatchRebalanced: expected an out of range offset error")
+	}
+}
+
+func TestParseBatchRebalancedSumsDuplicateMarkets(t *testing.T) {
+	uint256Array, _ := abi.NewType("uint256[]", "", nil)
+	args := abi.Arguments{{Type: uint256Array}, {Type: uint256Array}}
+	data, err := args.Pack(
+		[]*big.Int{big.NewInt(7), big.NewInt(8), big.NewInt(7)},
+		[]*big.Int{big.NewInt(100), big.NewInt(5), big.NewInt(20)},
+	)
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+
+	batch, err := parseBatchRebalanced(types.Log{Data: data}, "b", config.NewBigInt(1), config.NewBigInt(1), "0x01")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(batch.Principals) != 2 || batch.Principals["7"].String() != "120" || batch.Principals["8"].String() != "5" {
+		t.Errorf("principals %v, want 7 => 120 and 8 => 5", batch.Principals)
+	}
+}
+
+func TestParseProtocolRegisteredPicksDecoderByABIVersion(t *testing.T) {
+	legacyABI := strings.ReplaceAll(protocolRegisteredABI, `"indexed":true`, `"indexed":false`)
+	parsed, err := abi.JSON(strings.NewReader(legacyABI))
+	if err != nil {
+		t.Fatalf("parse abi: %v", err)
+	}
+	data, err := parsed.Events["ProtocolRegistered"].Inputs.Pack(uint8(1), protocolAddress, "Lido", uint8(2))
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	legacy := types.Log{Topics: []common.Hash{ProtocolRegisteredSignature}, Data: data, BlockNumber: 99}
+	current := protocolRegisteredLog(t, 0, "Aave", 1)
+	current.BlockNumber = 100
+
+	contract := benchContract("ProtocolSelector")
+	contract.ABIVersions = []config.ABIVersion{
+		{Name: ProtocolSelectorV1, FromBlock: 0},
+		{Name: "protocol-selector-v2", FromBlock: 100},
+	}
+
+	tests := []struct {
+		name     string
+		log      types.Log
+		want     string
+		wantType config.ProtocolType
+		wantRisk config.RiskLevel
+	}{
+		{"before the upgrade", legacy, "Lido", config.ProtocolTypeStaking, config.RiskLevelHigh},
+		{"after the upgrade", current, "Aave", config.ProtocolTypeLending, config.RiskLevelMedium},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entity, err := ParseContractLog(contract, tt.log, 1)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			protocol := entity.(*config.ProtocolRegistered)
+			if protocol.Name != tt.want || protocol.ProtocolType != tt.wantType || protocol.RiskLevel != tt.wantRisk {
+				t.Errorf("got %q type %s risk %s, want %q type %s risk %s",
+					protocol.Name, protocol.ProtocolType, protocol.RiskLevel, tt.want, tt.wantType, tt.wantRisk)
+			}
+			if protocol.ProtocolAddress != addressHex(protocolAddress.Bytes()) {
+				t.Errorf("protocol address %s", protocol.ProtocolAddress)
+			}
+		})
+	}
+
+	// The same legacy log past the upgrade block goes to the current decoder, which can't read it.
+	legacy.BlockNumber = 100
+	if _, err := ParseContractLog(contract, legacy, 1); !errors.Is(err, ErrMalformedLog) {
+		t.Errorf("legacy layout after the upgrade: got %v, want a malformed log error", err)
+	}
+}
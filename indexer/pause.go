@@ -0,0 +1,153 @@
+package indexer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func GetContractStatus(db *gorm.DB, contractAddress string) (config.ContractStatus, error) {
+	var status config.ContractStatus
+	err := db.Where("LOWER(contract_address) = LOWER(?)", contractAddress).First(&status).Error
+	return status, err
+}
+
+func GetContractStatuses(db *gorm.DB) ([]config.ContractStatus, error) {
+	q := db.Order("contract_name")
+	if config.CFG.Environment != "" {
+		q = q.Where("environment = ?", config.CFG.Environment)
+	}
+
+	var statuses []config.ContractStatus
+	if err := q.Find(&statuses).Error; err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+func updateContractStatus(db *gorm.DB, contract config.Contract, entities []interface{}) error {
+	var latest *config.ContractStatus
+	for _, entity := range entities {
+		status, ok := pauseStatus(contract, entity)
+		if !ok {
+			continue
+		}
+		if latest == nil || statusAfter(status, *latest) {
+			latest = &status
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	return upsertContractStatus(db, *latest)
+}
+
+func upsertContractStatus(db *gorm.DB, status config.ContractStatus) error {
+	// Batches may be replayed or stored out of order, only a later event may replace the stored status.
+	return upsertIfLater(db, &status, status.ContractAddress, status.SinceBlock, status.SinceLogIndex)
+}
+
+func upsertIfLater(db *gorm.DB, row interface{}, contractAddress string, sinceBlock int64, sinceLogIndex uint) error {
+	table := config.GetTableName(db, row)
+	if db.Dialector.Name() != "mysql" {
+		return db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "contract_address"}},
+			UpdateAll: true,
+			Where: clause.Where{Exprs: []clause.Expression{clause.Expr{
+				SQL: fmt.Sprintf("%[1]s.since_block < excluded.since_block OR (%[1]s.since_block = excluded.since_block AND %[1]s.since_log_index <= excluded.since_log_index)", table),
+			}}},
+		}).Create(row).Error
+	}
+
+	// MySQL drops the WHERE of ON DUPLICATE KEY UPDATE, so compare against the locked row instead.
+	return db.Transaction(func(tx *gorm.DB) error {
+		var current struct {
+			SinceBlock    int64
+			SinceLogIndex uint
+		}
+		result := tx.Table(table).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("since_block, since_log_index").
+			Where("contract_address = ?", contractAddress).
+			Limit(1).Scan(&current)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 && (current.SinceBlock > sinceBlock ||
+			(current.SinceBlock == sinceBlock && current.SinceLogIndex > sinceLogIndex)) {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "contract_address"}},
+			UpdateAll: true,
+		}).Create(row).Error
+	})
+}
+
+func pauseStatus(contract config.Contract, entity interface{}) (config.ContractStatus, bool) {
+	status := config.ContractStatus{
+		ContractAddress: contract.Address,
+		ContractName:    contract.Name,
+		Network:         contract.Network,
+		Environment:     config.CFG.Environment,
+		UpdatedAt:       time.Now(),
+	}
+
+	switch e := entity.(type) {
+	case *config.Paused:
+		status.Paused, status.Account = true, e.Account
+		status.SinceBlock, status.SinceLogIndex, status.TransactionHash = e.BlockNumber.Int64(), e.LogIndex, e.TransactionHash
+	case *config.Unpaused:
+		status.Paused, status.Account = false, e.Account
+		status.SinceBlock, status.SinceLogIndex, status.TransactionHash = e.BlockNumber.Int64(), e.LogIndex, e.TransactionHash
+	default:
+		return config.ContractStatus{}, false
+	}
+	return status, true
+}
+
+func statusAfter(a, b config.ContractStatus) bool {
+	if a.SinceBlock != b.SinceBlock {
+		return a.SinceBlock > b.SinceBlock
+	}
+	return a.SinceLogIndex > b.SinceLogIndex
+}
+
+func hasPauseEvents(entities []interface{}) bool {
+	for _, entity := range entities {
+		switch entity.(type) {
+		case *config.Paused, *config.Unpaused:
+			return true
+		}
+	}
+	return false
+}
+
+func rebuildContractStatus(db *gorm.DB, contract config.Contract) error {
+	// After a reorg removes pause events, fall back to the latest ones still stored.
+	var candidates []interface{}
+	for _, model := range []interface{}{&config.Paused{}, &config.Unpaused{}} {
+		q := db.Order("block_number DESC, log_index DESC")
+		if contract.Network != "" {
+			q = q.Where("network = ?", contract.Network)
+		}
+		if config.CFG.Environment != "" {
+			q = q.Where("environment = ?", config.CFG.Environment)
+		}
+		result := q.Limit(1).Find(model)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		candidates = append(candidates, model)
+	}
+
+	if err := db.Where("contract_address = ?", contract.Address).Delete(&config.ContractStatus{}).Error; err != nil {
+		return err
+	}
+	return updateContractStatus(db, contract, candidates)
+}
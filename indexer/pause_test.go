@@ -0,0 +1,44 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/evaafi/go-indexer/config"
+)
+
+func TestUpsertContractStatusKeepsLatestEvent(t *testing.T) {
+	db := openTestDB(t, &config.ContractStatus{})
+	address := "0x00000000000000000000000000000000000000aa"
+
+	steps := []struct {
+		paused   bool
+		block    int64
+		logIndex uint
+		want     bool
+	}{
+		{true, 100, 2, true},
+		{false, 90, 0, true},
+		{false, 100, 1, true},
+		{false, 100, 3, false},
+		{true, 101, 0, true},
+	}
+	for i, step := range steps {
+		status := config.ContractStatus{
+			ContractAddress: address,
+			ContractName:    "ProtocolSelector",
+			Paused:          step.paused,
+			SinceBlock:      step.block,
+			SinceLogIndex:   step.logIndex,
+		}
+		if err := upsertContractStatus(db, status); err != nil {
+			t.Fatalf("step %d: upsert: %v", i, err)
+		}
+		stored, err := GetContractStatus(db, address)
+		if err != nil {
+			t.Fatalf("step %d: read: %v", i, err)
+		}
+		if stored.Paused != step.want {
+			t.Errorf("step %d: paused = %v, want %v (stored since %d/%d)", i, stored.Paused, step.want, stored.SinceBlock, stored.SinceLogIndex)
+		}
+	}
+}
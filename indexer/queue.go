@@ -0,0 +1,156 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+)
+
+type queuedBatch struct {
+	contract  config.Contract
+	entities  []interface{}
+	ranged    bool
+	fromBlock uint64
+	toBlock   uint64
+}
+
+var (
+	queueMu sync.Mutex
+	queue   = make(map[string]*queuedBatch)
+)
+
+func enqueue(contract config.Contract, entities []interface{}) {
+	queueMu.Lock()
+	queue[contract.Address] = &queuedBatch{contract: contract, entities: entities}
+	queueMu.Unlock()
+}
+
+func enqueueRange(contract config.Contract, entities []interface{}, fromBlock, toBlock uint64) {
+	queueMu.Lock()
+	queue[contract.Address] = &queuedBatch{contract: contract, entities: entities, ranged: true, fromBlock: fromBlock, toBlock: toBlock}
+	queueMu.Unlock()
+}
+
+func queuedRange(contract config.Contract, fromBlock uint64) (*queuedBatch, bool) {
+	// A range whose store failed stays queued, so a retry starting at the same block can store it without refetching.
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	batch, ok := queue[contract.Address]
+	if !ok || !batch.ranged || batch.fromBlock != fromBlock {
+		return nil, false
+	}
+	return batch, true
+}
+
+func dequeue(contract config.Contract) {
+	queueMu.Lock()
+	delete(queue, contract.Address)
+	queueMu.Unlock()
+}
+
+func SaveQueue() error {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	bufferMu.Lock()
+	for address, b := range buffers {
+		if batch, ok := queue[address]; ok {
+			b.entities = append(batch.entities, b.entities...)
+		}
+		queue[address] = &queuedBatch{contract: b.contract, entities: b.entities}
+	}
+	buffers = make(map[string]*insertBuffer)
+	bufferMu.Unlock()
+
+	if len(queue) == 0 {
+		return nil
+	}
+
+	db, err := config.GetDBInstance()
+	if err != nil {
+		return err
+	}
+
+	var rows []config.QueuedEntity
+	for _, batch := range queue {
+		for _, entity := range batch.entities {
+			payload, err := json.Marshal(entity)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s: %w", eventTypeName(entity), err)
+			}
+			rows = append(rows, config.QueuedEntity{
+				ContractAddress: batch.contract.Address,
+				EventType:       eventTypeName(entity),
+				Payload:         string(payload),
+			})
+		}
+	}
+
+	if err := db.Create(&rows).Error; err != nil {
+		return fmt.Errorf("failed to persist queue: %w", err)
+	}
+
+	fmt.Printf("Persisted %d queued entities\n", len(rows))
+	queue = make(map[string]*queuedBatch)
+	return nil
+}
+
+func ReplayQueue(ctx context.Context, db *gorm.DB, sink EventSink) error {
+	var rows []config.QueuedEntity
+	if err := db.Order("id").Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to load queue: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	batches := make(map[string][]interface{})
+	for _, row := range rows {
+		entity, err := newEntity(row.EventType)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(row.Payload), entity); err != nil {
+			return fmt.Errorf("failed to decode queued %s %d: %w", row.EventType, row.ID, err)
+		}
+		batches[row.ContractAddress] = append(batches[row.ContractAddress], entity)
+	}
+
+	for address, entities := range batches {
+		contract, ok := contractByAddress(address)
+		if !ok {
+			contract = config.Contract{Address: address}
+		}
+		if err := sink.Store(ctx, contract, entities); err != nil {
+			return fmt.Errorf("failed to replay queue for %s: %w", address, err)
+		}
+	}
+
+	if err := db.Delete(&rows).Error; err != nil {
+		return fmt.Errorf("failed to clear replayed queue: %w", err)
+	}
+
+	fmt.Printf("Replayed %d queued entities\n", len(rows))
+	return nil
+}
+
+func newEntity(eventType string) (interface{}, error) {
+	models := []interface{}{&config.RawEvent{}}
+	for _, tables := range config.ContractTables {
+		models = append(models, tables...)
+	}
+
+	for _, model := range models {
+		if eventTypeName(model) == eventType {
+			return reflect.New(reflect.TypeOf(model).Elem()).Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown queued event type %s", eventType)
+}
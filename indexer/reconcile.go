@@ -0,0 +1,155 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+)
+
+func Reconcile(ctx context.Context, cfg config.Config, db *gorm.DB, w io.Writer, fromBlock, toBlock uint64) (bool, error) {
+	if toBlock < fromBlock {
+		return false, fmt.Errorf("invalid block range %d-%d", fromBlock, toBlock)
+	}
+
+	matched := true
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NETWORK\tCONTRACT\tEVENT\tON-CHAIN\tDB\tDIFF")
+
+	for _, network := range cfg.IndexedNetworks() {
+		ok, err := reconcileNetwork(ctx, cfg, db, tw, network, fromBlock, toBlock)
+		if err != nil {
+			return false, err
+		}
+		matched = matched && ok
+	}
+
+	return matched, tw.Flush()
+}
+
+func reconcileNetwork(ctx context.Context, cfg config.Config, db *gorm.DB, w io.Writer, network config.NetworkEndpoint, fromBlock, toBlock uint64) (bool, error) {
+	rpcClient, err := NewRPCClient(network.RPCEndpoint, RPCOptionsFromConfig(cfg))
+	if err != nil {
+		return false, err
+	}
+	clients := map[string]*RPCClient{network.RPCEndpoint: rpcClient}
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+
+	matched := true
+	for _, contract := range EnabledContracts(SupportedContracts(config.NetworkContracts[network.Name])) {
+		client, err := contractRPCClient(ctx, cfg, clients, contract, rpcClient)
+		if err != nil {
+			return false, fmt.Errorf("failed to create RPC client for %s: %w", contract.Name, err)
+		}
+		onChain, err := countOnChainEvents(ctx, client, contract, fromBlock, toBlock, cfg.BlockBatchSize)
+		if err != nil {
+			return false, fmt.Errorf("failed to count on-chain events for %s: %w", contract.Name, err)
+		}
+		stored, err := countStoredEvents(db.WithContext(ctx), contract, fromBlock, toBlock)
+		if err != nil {
+			return false, fmt.Errorf("failed to count stored events for %s: %w", contract.Name, err)
+		}
+
+		var eventTypes []string
+		for eventType := range onChain {
+			eventTypes = append(eventTypes, eventType)
+		}
+		for eventType := range stored {
+			if _, ok := onChain[eventType]; !ok {
+				eventTypes = append(eventTypes, eventType)
+			}
+		}
+		sort.Strings(eventTypes)
+
+		for _, eventType := range eventTypes {
+			diff := stored[eventType] - onChain[eventType]
+			if diff == 0 && onChain[eventType] == 0 {
+				continue
+			}
+			if diff != 0 {
+				matched = false
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%+d\n", network.Name, contract.Name, eventType, onChain[eventType], stored[eventType], diff)
+		}
+	}
+
+	return matched, nil
+}
+
+func countOnChainEvents(ctx context.Context, rpcClient *RPCClient, contract config.Contract, fromBlock, toBlock uint64, batchSize int) (map[string]int64, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	counts := make(map[string]int64)
+	for start := fromBlock; start <= toBlock; start += uint64(batchSize) {
+		end := start + uint64(batchSize) - 1
+		if end > toBlock {
+			end = toBlock
+		}
+
+		// Queries and filters match processBlockRange, so events the indexer deliberately skips are not counted.
+		topics, ok := logTopics(contract, end)
+		if !ok {
+			continue
+		}
+		logs, err := rpcClient.GetLogsWithTopics(ctx, contract.Address, start, end, topics)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, log := range logs {
+			if log.Removed {
+				continue
+			}
+			entity, err := ParseContractLog(contract, log, 0)
+			if err != nil {
+				counts[eventTypeName(&config.RawEvent{})]++
+				continue
+			}
+			if !eventStored(contract, eventTypeName(entity), log.BlockNumber) {
+				continue
+			}
+			counts[eventTypeName(entity)]++
+		}
+	}
+
+	return counts, nil
+}
+
+func countStoredEvents(db *gorm.DB, contract config.Contract, fromBlock, toBlock uint64) (map[string]int64, error) {
+	counts := make(map[string]int64)
+
+	for _, model := range config.ContractTables[contract.Name] {
+		query := networkScope(db.Model(model).Where("block_number BETWEEN ? AND ?", fromBlock, toBlock), contract)
+		if config.CFG.Environment != "" {
+			query = query.Where("environment = ?", config.CFG.Environment)
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", eventTypeName(model), err)
+		}
+		counts[eventTypeName(model)] = count
+	}
+
+	query := db.Model(&config.RawEvent{}).
+		Where("contract_address = ? AND block_number BETWEEN ? AND ?", contract.Address, fromBlock, toBlock)
+	if config.CFG.Environment != "" {
+		query = query.Where("environment = ?", config.CFG.Environment)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to count raw events: %w", err)
+	}
+	counts[eventTypeName(&config.RawEvent{})] = count
+
+	return counts, nil
+}
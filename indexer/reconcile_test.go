@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/evaafi/go-indexer/config"
+)
+
+func TestCountOnChainEventsAppliesEventFilters(t *testing.T) {
+	saved := config.CFG
+	defer func() { config.CFG = saved }()
+	config.CFG.ExcludeEvents = []string{"MarketResolved"}
+
+	contract := benchContract("WhizyPredictionMarket")
+	contract.EventStartBlocks = map[string]uint64{"MarketCreated": 20}
+	signatures := eventSignatures[contract.Name]
+
+	logs := []types.Log{
+		benchLog("BetPlaced", signatures["BetPlaced"], 0),
+		benchLog("MarketCreated", signatures["MarketCreated"], 1),
+		benchLog("MarketResolved", signatures["MarketResolved"], 2),
+		benchLog("MarketCreated", signatures["MarketCreated"], 3),
+	}
+	for i := range logs {
+		logs[i].BlockNumber = 10
+	}
+	logs[3].BlockNumber = 20
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": logs})
+	}))
+	defer server.Close()
+
+	client, err := NewRPCClient(server.URL, RPCOptions{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewRPCClient: %v", err)
+	}
+	defer client.Close()
+
+	counts, err := countOnChainEvents(context.Background(), client, contract, 10, 20, 100)
+	if err != nil {
+		t.Fatalf("countOnChainEvents: %v", err)
+	}
+	want := map[string]int64{"BetPlaced": 1, "MarketCreated": 1}
+	if len(counts) != len(want) {
+		t.Fatalf("counts %v, want %v", counts, want)
+	}
+	for eventType, n := range want {
+		if counts[eventType] != n {
+			t.Errorf("%s counted %d, want %d", eventType, counts[eventType], n)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+)
+
+var ErrReorgTooDeep = errors.New("reorg exceeds maxReorgDepth")
+
+func checkReorgDepth(contract config.Contract, removed []interface{}, head uint64) error {
+	for _, entity := range removed {
+		blockNumber := entityBlockNumber(entity)
+		if blockNumber > head {
+			continue
+		}
+		if depth := head - blockNumber + 1; depth > config.CFG.MaxReorgDepth {
+			return fmt.Errorf("%w: %s would roll back %d blocks to block %d, limit is %d",
+				ErrReorgTooDeep, contract.Name, depth, blockNumber, config.CFG.MaxReorgDepth)
+		}
+	}
+	return nil
+}
+
+func contractByAddress(address string) (config.Contract, bool) {
+	for _, contract := range config.Contracts {
+		if strings.EqualFold(contract.Address, address) {
+			return contract, true
+		}
+	}
+	return config.Contract{}, false
+}
+
+func contractTables(contractAddress string) (config.Contract, []interface{}, error) {
+	contract, ok := contractByAddress(contractAddress)
+	if !ok {
+		return config.Contract{}, nil, fmt.Errorf("unknown contract address %s", contractAddress)
+	}
+
+	tables, ok := config.ContractTables[contract.Name]
+	if !ok {
+		return config.Contract{}, nil, fmt.Errorf("no tables registered for contract %s", contract.Name)
+	}
+
+	return contract, tables, nil
+}
+
+func DeleteEventsFromBlock(db *gorm.DB, contractAddress string, fromBlock uint64) (map[string]int64, error) {
+	contract, tables, err := contractTables(contractAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		stats := make(map[blockEventKey]int64)
+		for _, model := range tables {
+			query := func() *gorm.DB {
+				query := networkScope(unsafeRows(tx.Where("block_number >= ?", fromBlock)), contract)
+				if config.CFG.Environment != "" {
+					query = query.Where("environment = ?", config.CFG.Environment)
+				}
+				return query
+			}
+			deleted, err := deleteCounted(query, model, stats)
+			if err != nil {
+				return fmt.Errorf("failed to delete %s from block %d: %w", eventTypeName(model), fromBlock, err)
+			}
+			counts[config.GetTableName(tx, model)] = deleted
+		}
+
+		query := func() *gorm.DB {
+			query := networkScope(unsafeRows(tx.Where("contract_address = ? AND block_number >= ?", contract.Address, fromBlock)), contract)
+			if config.CFG.Environment != "" {
+				query = query.Where("environment = ?", config.CFG.Environment)
+			}
+			return query
+		}
+		deleted, err := deleteCounted(query, &config.RawEvent{}, stats)
+		if err != nil {
+			return fmt.Errorf("failed to delete raw events from block %d: %w", fromBlock, err)
+		}
+		counts[config.GetTableName(tx, &config.RawEvent{})] = deleted
+
+		// Finalized rows survive the delete, so their blocks keep the part of the count that is still stored.
+		if err := decrementBlockEventStats(tx, contract.Address, stats); err != nil {
+			return fmt.Errorf("failed to update block event stats from block %d: %w", fromBlock, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// deleteCounted deletes the rows query matches, adding how many went from each block to stats.
+func deleteCounted(query func() *gorm.DB, model interface{}, stats map[blockEventKey]int64) (int64, error) {
+	var rows []struct {
+		BlockNumber int64
+		Count       int64
+	}
+	if err := query().Model(model).Select("block_number, COUNT(*) AS count").Group("block_number").Scan(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	result := query().Delete(model)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	for _, row := range rows {
+		stats[blockEventKey{blockNumber: uint64(row.BlockNumber), eventType: eventTypeName(model)}] += row.Count
+	}
+	return result.RowsAffected, nil
+}
+
+func FinalizeEvents(db *gorm.DB, contractAddress string, throughBlock uint64) (int64, error) {
+	contract, tables, err := contractTables(contractAddress)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range tables {
+			query := networkScope(tx.Model(model).Where("finalized = ? AND block_number <= ?", false, throughBlock), contract)
+			if config.CFG.Environment != "" {
+				query = query.Where("environment = ?", config.CFG.Environment)
+			}
+			result := query.Update("finalized", true)
+			if result.Error != nil {
+				return fmt.Errorf("failed to finalize %s through block %d: %w", eventTypeName(model), throughBlock, result.Error)
+			}
+			total += result.RowsAffected
+		}
+
+		query := tx.Model(&config.RawEvent{}).
+			Where("contract_address = ? AND finalized = ? AND block_number <= ?", contract.Address, false, throughBlock)
+		if config.CFG.Environment != "" {
+			query = query.Where("environment = ?", config.CFG.Environment)
+		}
+		result := query.Update("finalized", true)
+		if result.Error != nil {
+			return fmt.Errorf("failed to finalize raw events through block %d: %w", throughBlock, result.Error)
+		}
+		total += result.RowsAffected
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func unsafeRows(query *gorm.DB) *gorm.DB {
+	if config.CFG.Confirmations == 0 {
+		return query
+	}
+	return query.Where("finalized = ?", false)
+}
+
+func networkScope(query *gorm.DB, contract config.Contract) *gorm.DB {
+	if len(config.CFG.Networks) == 0 {
+		return query
+	}
+	return query.Where("network = ?", contract.Network)
+}
@@ -0,0 +1,122 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+)
+
+const reparseBatchSize = 500
+
+type ReparseResult struct {
+	Decoded int64
+	Unknown int64
+	Failed  int64
+}
+
+func ReparseRawEvents(ctx context.Context, db *gorm.DB) (ReparseResult, error) {
+	var result ReparseResult
+
+	query := db.WithContext(ctx).Model(&config.RawEvent{})
+	if config.CFG.Environment != "" {
+		query = query.Where("environment = ?", config.CFG.Environment)
+	}
+
+	var batch []config.RawEvent
+	err := query.FindInBatches(&batch, reparseBatchSize, func(_ *gorm.DB, _ int) error {
+		var entities []interface{}
+		var decodedIDs []string
+		byContract := make(map[string][]interface{})
+
+		for _, raw := range batch {
+			log, err := rawEventLog(raw)
+			if err != nil {
+				fmt.Printf("Warning: raw event %s is not a valid log: %v\n", raw.ID, err)
+				result.Failed++
+				continue
+			}
+
+			entity, err := ParseLog(log, raw.ContractAddress, raw.BlockTimestamp.Uint64())
+			if errors.Is(err, ErrUnknownSignature) || errors.Is(err, ErrAnonymousEvent) {
+				result.Unknown++
+				continue
+			}
+			if err != nil {
+				fmt.Printf("Warning: raw event %s still fails to decode: %v\n", raw.ID, err)
+				result.Failed++
+				continue
+			}
+			setStringField(entity, "Network", raw.Network)
+
+			entities = append(entities, entity)
+			decodedIDs = append(decodedIDs, raw.ID)
+			byContract[raw.ContractAddress] = append(byContract[raw.ContractAddress], entity)
+		}
+
+		if len(entities) == 0 {
+			return nil
+		}
+
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for address, decoded := range byContract {
+				contract, _ := contractByAddress(address)
+				if err := storeEntities(tx, contract, decoded); err != nil {
+					return err
+				}
+			}
+			return tx.Where("id IN ?", decodedIDs).Delete(&config.RawEvent{}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store reparsed events: %w", err)
+		}
+		result.Decoded += int64(len(entities))
+
+		return nil
+	}).Error
+	if err != nil {
+		return result, err
+	}
+
+	if result.Decoded > 0 {
+		if err := RebuildBlockEventStats(db.WithContext(ctx)); err != nil {
+			return result, fmt.Errorf("failed to rebuild block event stats: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+func rawEventLog(raw config.RawEvent) (types.Log, error) {
+	var topics []common.Hash
+	if raw.Topics != "" {
+		for _, topic := range strings.Split(raw.Topics, ",") {
+			b, err := hexutil.Decode(topic)
+			if err != nil || len(b) != common.HashLength {
+				return types.Log{}, fmt.Errorf("invalid topic %q", topic)
+			}
+			topics = append(topics, common.BytesToHash(b))
+		}
+	}
+
+	data, err := hexutil.Decode(raw.Data)
+	if err != nil {
+		return types.Log{}, fmt.Errorf("invalid data: %w", err)
+	}
+
+	return types.Log{
+		Address:     common.HexToAddress(raw.ContractAddress),
+		Topics:      topics,
+		Data:        data,
+		BlockNumber: raw.BlockNumber.Uint64(),
+		TxHash:      common.HexToHash(raw.TransactionHash),
+		BlockHash:   common.HexToHash(raw.BlockHash),
+		Index:       raw.LogIndex,
+	}, nil
+}
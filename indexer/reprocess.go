@@ -0,0 +1,137 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/evaafi/go-indexer/config"
+)
+
+type reprocessedLog struct {
+	Index     uint
+	Contract  string
+	EventType string
+	Entity    interface{}
+	Err       error
+}
+
+func ReprocessTx(ctx context.Context, cfg config.Config, sink EventSink, w io.Writer, txHash string) error {
+	if !isTxHash(txHash) {
+		return fmt.Errorf("invalid transaction hash %q", txHash)
+	}
+	hash := common.HexToHash(txHash)
+
+	receipt, network, rpcClient, err := findReceipt(ctx, cfg, hash)
+	if err != nil {
+		return err
+	}
+	defer rpcClient.Close()
+
+	timestamp, err := rpcClient.GetBlockTimestamp(ctx, receipt.BlockNumber.Uint64())
+	if err != nil {
+		return fmt.Errorf("failed to get block %d timestamp: %w", receipt.BlockNumber.Uint64(), err)
+	}
+
+	fmt.Fprintf(w, "Transaction %s on %s, block %d, status %d, %d logs\n",
+		hash.Hex(), network, receipt.BlockNumber.Uint64(), receipt.Status, len(receipt.Logs))
+
+	var results []reprocessedLog
+	batches := make(map[string][]interface{})
+	contracts := make(map[string]config.Contract)
+	for _, log := range receipt.Logs {
+		contract, ok := networkContract(network, log.Address)
+		if !ok {
+			continue
+		}
+
+		result := reprocessedLog{Index: log.Index, Contract: contract.Name}
+		entity, err := ParseContractLog(contract, *log, timestamp)
+		if err != nil {
+			result.Err = err
+		} else {
+			setStringField(entity, "Network", contract.Network)
+			result.Entity, result.EventType = entity, eventTypeName(entity)
+			batches[contract.Address] = append(batches[contract.Address], entity)
+			contracts[contract.Address] = contract
+		}
+		results = append(results, result)
+	}
+
+	if err := printReprocessed(w, results); err != nil {
+		return err
+	}
+
+	if sink == nil {
+		return nil
+	}
+	for address, entities := range batches {
+		if err := sink.Store(ctx, contracts[address], entities); err != nil {
+			return fmt.Errorf("failed to store entities for %s: %w", contracts[address].Name, err)
+		}
+		fmt.Fprintf(w, "Stored %d entities for %s\n", len(entities), contracts[address].Name)
+	}
+	return nil
+}
+
+func findReceipt(ctx context.Context, cfg config.Config, hash common.Hash) (*types.Receipt, string, *RPCClient, error) {
+	for _, network := range cfg.IndexedNetworks() {
+		rpcClient, err := NewRPCClient(network.RPCEndpoint, RPCOptionsFromConfig(cfg))
+		if err != nil {
+			return nil, "", nil, err
+		}
+		receipt, err := rpcClient.GetTransactionReceipt(ctx, hash)
+		if err == nil {
+			return receipt, network.Name, rpcClient, nil
+		}
+		rpcClient.Close()
+		if !errors.Is(err, ethereum.NotFound) {
+			return nil, "", nil, fmt.Errorf("failed to get receipt on %s: %w", network.Name, err)
+		}
+	}
+	return nil, "", nil, fmt.Errorf("transaction %s not found on any indexed network", hash.Hex())
+}
+
+func networkContract(network string, address common.Address) (config.Contract, bool) {
+	for _, contract := range config.NetworkContracts[network] {
+		if strings.EqualFold(contract.Address, address.Hex()) {
+			return contract, true
+		}
+	}
+	return contractByAddress(address.Hex())
+}
+
+func printReprocessed(w io.Writer, results []reprocessedLog) error {
+	if len(results) == 0 {
+		fmt.Fprintln(w, "No logs from tracked contracts")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LOG\tCONTRACT\tEVENT\tRESULT")
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(tw, "%d\t%s\t-\terror: %v\n", result.Index, result.Contract, result.Err)
+			continue
+		}
+		data, err := json.Marshal(result.Entity)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", result.EventType, err)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", result.Index, result.Contract, result.EventType, data)
+	}
+	return tw.Flush()
+}
+
+func isTxHash(value string) bool {
+	b, err := hexutil.Decode(value)
+	return err == nil && len(b) == common.HashLength
+}
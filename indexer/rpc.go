@@ -2,58 +2,531 @@ package indexer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/evaafi/go-indexer/config"
+	"golang.org/x/time/rate"
 )
 
+var ErrBlockNotFound = errors.New("block not found")
+
 type RPCClient struct {
-	client *ethclient.Client
+	client     *ethclient.Client
+	timeout    time.Duration
+	timestamps *timestampCache
+	limiter    *rate.Limiter
+	minRange   uint64
+	logSource  config.LogSource
+
+	timestampProvider TimestampProvider
+
+	finalizedTag bool
+}
+
+type RPCOptions struct {
+	Timeout            time.Duration
+	TimestampCacheSize int
+	RateLimit          float64
+	RateBurst          int
+	MinLogRange        int
+	LogSource          config.LogSource
+	Headers            map[string]string
 }
 
-func NewRPCClient(endpoint string) (*RPCClient, error) {
-	client, err := ethclient.Dial(endpoint)
+func RPCOptionsFromConfig(cfg config.Config) RPCOptions {
+	return RPCOptions{
+		Timeout:            cfg.RPCTimeout,
+		TimestampCacheSize: cfg.TimestampCacheSize,
+		RateLimit:          cfg.RPCRateLimit,
+		RateBurst:          cfg.RPCRateBurst,
+		MinLogRange:        cfg.MinLogRange,
+		LogSource:          cfg.LogSource,
+		Headers:            cfg.RPCHeaders,
+	}
+}
+
+func NewRPCClient(endpoint string, opts RPCOptions) (*RPCClient, error) {
+	var dialOpts []rpc.ClientOption
+	if len(opts.Headers) > 0 {
+		headers := make(http.Header)
+		for name, value := range opts.Headers {
+			headers.Set(name, value)
+		}
+		dialOpts = append(dialOpts, rpc.WithHeaders(headers))
+	}
+
+	rpcClient, err := rpc.DialOptions(context.Background(), endpoint, dialOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to RPC endpoint: %w", err)
 	}
+	client := ethclient.NewClient(rpcClient)
 
-	return &RPCClient{client: client}, nil
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if opts.RateLimit > 0 {
+		burst := opts.RateBurst
+		if burst <= 0 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(rate.Limit(opts.RateLimit), burst)
+	}
+
+	return &RPCClient{
+		client:     client,
+		timeout:    opts.Timeout,
+		timestamps: newTimestampCache(opts.TimestampCacheSize),
+		limiter:    limiter,
+		minRange:   uint64(max(opts.MinLogRange, 1)),
+		logSource:  opts.LogSource,
+	}, nil
+}
+
+func (r *RPCClient) wait(ctx context.Context) error {
+	if err := r.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter: %w", err)
+	}
+	return nil
+}
+
+func (r *RPCClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.timeout)
 }
 
 func (r *RPCClient) GetLatestBlockNumber(ctx context.Context) (uint64, error) {
+	if err := r.wait(ctx); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	header, err := r.client.HeaderByNumber(ctx, nil)
 	if err != nil {
+		recordRPCError(ctx, err)
 		return 0, err
 	}
 	return header.Number.Uint64(), nil
 }
 
+func (r *RPCClient) GetFinalizedBlockNumber(ctx context.Context) (uint64, error) {
+	if err := r.wait(ctx); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	header, err := r.client.HeaderByNumber(ctx, big.NewInt(int64(rpc.FinalizedBlockNumber)))
+	if err != nil {
+		recordRPCError(ctx, err)
+		return 0, err
+	}
+	return header.Number.Uint64(), nil
+}
+
+func (r *RPCClient) ProbeFinalizedTag(ctx context.Context) bool {
+	_, err := r.GetFinalizedBlockNumber(ctx)
+	r.finalizedTag = err == nil
+	return r.finalizedTag
+}
+
+func (r *RPCClient) GetSafeBlockNumber(ctx context.Context, latestBlock uint64) (uint64, bool) {
+	if r.finalizedTag {
+		finalized, err := r.GetFinalizedBlockNumber(ctx)
+		if err == nil {
+			return finalized, true
+		}
+		fmt.Printf("Warning: failed to get finalized block, falling back to confirmations: %v\n", err)
+	}
+
+	if latestBlock < config.CFG.Confirmations {
+		return 0, false
+	}
+	return latestBlock - config.CFG.Confirmations, true
+}
+
 func (r *RPCClient) GetBlockWithTimestamp(ctx context.Context, blockNum uint64) (*types.Header, error) {
-	return r.client.HeaderByNumber(ctx, big.NewInt(int64(blockNum)))
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	header, err := r.client.HeaderByNumber(ctx, new(big.Int).SetUint64(blockNum))
+	recordRPCError(ctx, err)
+	if errors.Is(err, ethereum.NotFound) || (err == nil && header == nil) {
+		return nil, fmt.Errorf("%w: %d", ErrBlockNotFound, blockNum)
+	}
+	return header, err
 }
 
-func (r *RPCClient) GetLogs(ctx context.Context, contractAddress string, fromBlock, toBlock uint64) ([]types.Log, error) {
-	query := ethereum.FilterQuery{
-		FromBlock: big.NewInt(int64(fromBlock)),
-		ToBlock:   big.NewInt(int64(toBlock)),
-		Addresses: []common.Address{
-			common.HexToAddress(contractAddress),
-		},
-		Topics: [][]common.Hash{},
+func (r *RPCClient) GetTransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
 	}
 
-	logs, err := r.client.FilterLogs(ctx, query)
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	receipt, err := r.client.TransactionReceipt(ctx, txHash)
+	recordRPCError(ctx, err)
+	return receipt, err
+}
+
+func (r *RPCClient) GetCode(ctx context.Context, address string) ([]byte, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	code, err := r.client.CodeAt(ctx, common.HexToAddress(address), nil)
+	recordRPCError(ctx, err)
+	return code, err
+}
+
+func (r *RPCClient) GetCodeAtBlock(ctx context.Context, address string, blockNum uint64) ([]byte, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	code, err := r.client.CodeAt(ctx, common.HexToAddress(address), new(big.Int).SetUint64(blockNum))
+	recordRPCError(ctx, err)
+	return code, err
+}
+
+func (r *RPCClient) HasCode(ctx context.Context, address string) (bool, error) {
+	code, err := r.GetCode(ctx, address)
 	if err != nil {
+		return false, err
+	}
+	return len(code) > 0, nil
+}
+
+func (r *RPCClient) GetBlockTimestamp(ctx context.Context, blockNum uint64) (uint64, error) {
+	if timestamp, ok := r.timestamps.Get(blockNum); ok {
+		return timestamp, nil
+	}
+
+	header, err := r.GetBlockWithTimestamp(ctx, blockNum)
+	if err != nil {
+		return 0, err
+	}
+
+	r.timestamps.Add(blockNum, header.Time)
+	return header.Time, nil
+}
+
+func (r *RPCClient) GetLogs(ctx context.Context, contractAddress string, fromBlock, toBlock uint64) ([]types.Log, error) {
+	return r.GetLogsWithTopics(ctx, contractAddress, fromBlock, toBlock, nil)
+}
+
+func (r *RPCClient) GetLogsWithTopics(ctx context.Context, contractAddress string, fromBlock, toBlock uint64, topics []common.Hash) ([]types.Log, error) {
+	address := common.HexToAddress(contractAddress)
+
+	if r.logSource == config.LogSourceReceipts {
+		var logs []types.Log
+		for blockNum := fromBlock; blockNum <= toBlock; blockNum++ {
+			header, err := r.GetBlockWithTimestamp(ctx, blockNum)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get block %d header: %w", blockNum, err)
+			}
+			blockLogs, err := r.receiptLogs(ctx, address, header.Hash(), topics)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch receipts for block %d: %w", blockNum, err)
+			}
+			logs = append(logs, blockLogs...)
+		}
+		return logs, nil
+	}
+
+	logs, err := r.filterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(fromBlock),
+		ToBlock:   new(big.Int).SetUint64(toBlock),
+		Addresses: []common.Address{address},
+		Topics:    topicFilter(topics),
+	})
+	if err == nil {
+		return logs, nil
+	}
+
+	// Smaller ranges only make a rate limited provider busier, so the caller's backoff handles those.
+	if isRateLimitError(err) {
 		return nil, fmt.Errorf("failed to fetch logs: %w", err)
 	}
+	if isTimeoutError(ctx, err) {
+		if toBlock-fromBlock+1 <= r.minRange {
+			return nil, fmt.Errorf("failed to fetch logs for blocks %d-%d at minimum range: %w", fromBlock, toBlock, err)
+		}
+		fmt.Printf("Warning: log query for blocks %d-%d timed out, retrying in smaller ranges\n", fromBlock, toBlock)
+	} else if !isLogLimitError(err) {
+		return nil, fmt.Errorf("failed to fetch logs: %w", err)
+	}
+
+	if fromBlock < toBlock {
+		mid := fromBlock + (toBlock-fromBlock)/2
+		left, err := r.GetLogsWithTopics(ctx, contractAddress, fromBlock, mid, topics)
+		if err != nil {
+			return nil, err
+		}
+		right, err := r.GetLogsWithTopics(ctx, contractAddress, mid+1, toBlock, topics)
+		if err != nil {
+			return nil, err
+		}
+		return append(left, right...), nil
+	}
+
+	return r.getBlockLogs(ctx, address, fromBlock, topics)
+}
+
+func (r *RPCClient) getBlockLogs(ctx context.Context, address common.Address, blockNum uint64, topics []common.Hash) ([]types.Log, error) {
+	header, err := r.GetBlockWithTimestamp(ctx, blockNum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block %d header: %w", blockNum, err)
+	}
+	blockHash := header.Hash()
+
+	logs, err := r.filterLogs(ctx, ethereum.FilterQuery{
+		BlockHash: &blockHash,
+		Addresses: []common.Address{address},
+		Topics:    topicFilter(topics),
+	})
+	if err == nil {
+		return logs, nil
+	}
+	if isRateLimitError(err) || !isLogLimitError(err) {
+		return nil, fmt.Errorf("failed to fetch logs for block %d by hash: %w", blockNum, err)
+	}
+
+	fmt.Printf("Warning: block %d exceeds log limits, falling back to receipts\n", blockNum)
 
+	logs, err = r.receiptLogs(ctx, address, blockHash, topics)
+	if err != nil {
+		return nil, fmt.Errorf("no strategy could fetch logs for block %d, receipts failed: %w", blockNum, err)
+	}
 	return logs, nil
 }
 
+func (r *RPCClient) receiptLogs(ctx context.Context, address common.Address, blockHash common.Hash, topics []common.Hash) ([]types.Log, error) {
+	receipts, err := r.blockReceipts(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []types.Log
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			if log.Address == address && matchesTopics(log, topics) {
+				logs = append(logs, *log)
+			}
+		}
+	}
+	return logs, nil
+}
+
+func (r *RPCClient) blockReceipts(ctx context.Context, blockHash common.Hash) ([]*types.Receipt, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	receiptCtx, cancel := r.withTimeout(ctx)
+	receipts, err := r.client.BlockReceipts(receiptCtx, rpc.BlockNumberOrHashWithHash(blockHash, false))
+	recordRPCError(receiptCtx, err)
+	cancel()
+	if err == nil {
+		return receipts, nil
+	}
+
+	// Not every provider implements eth_getBlockReceipts, fall back to the block body and one receipt per transaction.
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	blockCtx, cancel := r.withTimeout(ctx)
+	block, blockErr := r.client.BlockByHash(blockCtx, blockHash)
+	recordRPCError(blockCtx, blockErr)
+	cancel()
+	if blockErr != nil {
+		return nil, fmt.Errorf("block receipts failed: %w, block body failed: %w", err, blockErr)
+	}
+
+	receipts = make([]*types.Receipt, 0, len(block.Transactions()))
+	for _, tx := range block.Transactions() {
+		if err := r.wait(ctx); err != nil {
+			return nil, err
+		}
+		txCtx, cancel := r.withTimeout(ctx)
+		receipt, err := r.client.TransactionReceipt(txCtx, tx.Hash())
+		recordRPCError(txCtx, err)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get receipt for tx %s: %w", tx.Hash().Hex(), err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
+
+func topicFilter(topics []common.Hash) [][]common.Hash {
+	if len(topics) == 0 {
+		return nil
+	}
+	return [][]common.Hash{topics}
+}
+
+func matchesTopics(log *types.Log, topics []common.Hash) bool {
+	if len(topics) == 0 {
+		return true
+	}
+	if len(log.Topics) == 0 {
+		return false
+	}
+	for _, topic := range topics {
+		if log.Topics[0] == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RPCClient) filterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	logs, err := r.client.FilterLogs(ctx, query)
+	recordRPCError(ctx, err)
+	return logs, err
+}
+
+func (r *RPCClient) ProbeLogHistory(ctx context.Context, contractAddress string, blockNum uint64) error {
+	_, err := r.filterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(blockNum),
+		ToBlock:   new(big.Int).SetUint64(blockNum),
+		Addresses: []common.Address{common.HexToAddress(contractAddress)},
+	})
+	return err
+}
+
+// prunedHistoryCode is the JSON-RPC error code geth and Nethermind return for pruned block history.
+const prunedHistoryCode = 4444
+
+// Only messages nodes send for pruned history, a broader match would send other failures to an archive node.
+var prunedHistoryErrors = []string{
+	"missing trie node",
+	"pruned history unavailable",
+	"historical state unavailable",
+}
+
+func isPrunedHistoryError(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == prunedHistoryCode {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range prunedHistoryErrors {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+var logLimitErrors = []string{
+	"query returned more than",
+	"response size",
+	"block range",
+}
+
+func isTimeoutError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "timeout") || strings.Contains(msg, "timed out")
+}
+
+func isLogLimitError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range logLimitErrors {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+var rateLimitErrors = []string{
+	"rate limit",
+	"too many requests",
+	"request limit",
+	"exceeded the quota",
+	"credits",
+}
+
+func isRateLimitError(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range rateLimitErrors {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func isConnectionRefusedError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(strings.ToLower(err.Error()), "connection refused")
+}
+
+func classifyRPCError(err error) string {
+	// Rate limit messages may mention the range that was being fetched, so they are checked before log limits.
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || isTimeoutError(context.Background(), err):
+		return "timeout"
+	case isRateLimitError(err):
+		return "rate-limited"
+	case isConnectionRefusedError(err):
+		return "connection-refused"
+	case isLogLimitError(err):
+		return "range-too-large"
+	}
+	return "other"
+}
+
+func recordRPCError(callCtx context.Context, err error) {
+	// Missing blocks and receipts are answers, and cancellation comes from our own shutdown, not the provider.
+	if err == nil || errors.Is(err, ethereum.NotFound) || errors.Is(callCtx.Err(), context.Canceled) {
+		return
+	}
+	rpcErrors.Add(classifyRPCError(err), 1)
+}
+
 func (r *RPCClient) Close() {
 	r.client.Close()
 }
@@ -0,0 +1,84 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/history"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestClassifyRPCError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{context.DeadlineExceeded, "timeout"},
+		{rpc.HTTPError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests"}, "rate-limited"},
+		{errors.New("too many requests, please slow down"), "rate-limited"},
+		{errors.New("rate limit exceeded for block range 1-5000"), "rate-limited"},
+		{errors.New("monthly credits exceeded"), "rate-limited"},
+		{errors.New("dial tcp 127.0.0.1:8545: connect: connection refused"), "connection-refused"},
+		{errors.New("query returned more than 10000 results"), "range-too-large"},
+		{errors.New("block range is too wide"), "range-too-large"},
+		{errors.New("response size should not be greater than 10MB"), "range-too-large"},
+		{errors.New("too many open files"), "other"},
+		{errors.New("gas limit exceeded"), "other"},
+	}
+	for _, tt := range tests {
+		if got := classifyRPCError(tt.err); got != tt.want {
+			t.Errorf("classifyRPCError(%q) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestIsPrunedHistoryError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&history.PrunedHistoryError{}, true},
+		{errors.New("missing trie node 9a1f (path )"), true},
+		{errors.New("required historical state unavailable (reexec=128)"), true},
+		{errors.New("the method eth_getLogs does not exist/is not available"), false},
+		{errors.New("header not found"), false},
+		{errors.New("invalid block range params"), false},
+		{errors.New("query exceeds max history range"), false},
+	}
+	for _, tt := range tests {
+		if got := isPrunedHistoryError(tt.err); got != tt.want {
+			t.Errorf("isPrunedHistoryError(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestGetLogsWithTopicsDoesNotBisectWhenRateLimited(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client, err := NewRPCClient(server.URL, RPCOptions{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewRPCClient: %v", err)
+	}
+	defer client.Close()
+
+	_, err = client.GetLogsWithTopics(context.Background(), "0x00000000000000000000000000000000000000aa", 1, 1000, nil)
+	if err == nil {
+		t.Fatal("expected the rate limit error to be returned")
+	}
+	if !isRateLimitError(err) {
+		t.Errorf("returned error lost the rate limit cause: %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("made %d eth_getLogs calls, want 1", n)
+	}
+}
@@ -0,0 +1,84 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+)
+
+func SelfTest(ctx context.Context, cfg config.Config, db *gorm.DB) error {
+	var failures []error
+
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		// Without a database the remaining checks can't tell us anything useful.
+		return fmt.Errorf("database unreachable: %w", err)
+	}
+
+	clients := make(map[string]*RPCClient)
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+
+	for _, network := range cfg.IndexedNetworks() {
+		networkClient, err := selfTestClient(ctx, cfg, clients, network.RPCEndpoint)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("[%s] RPC endpoint unreachable: %w", network.Name, err))
+			continue
+		}
+
+		for _, contract := range EnabledContracts(SupportedContracts(config.NetworkContracts[network.Name])) {
+			if _, ok := cfg.BackfillRanges[contract.Name]; len(cfg.BackfillRanges) > 0 && !ok {
+				continue
+			}
+
+			client := networkClient
+			if contract.RPCEndpoint != "" {
+				client, err = selfTestClient(ctx, cfg, clients, contract.RPCEndpoint)
+				if err != nil {
+					failures = append(failures, fmt.Errorf("[%s] %s: dedicated RPC endpoint unreachable: %w", network.Name, contract.Name, err))
+					continue
+				}
+			}
+
+			hasCode, err := client.HasCode(ctx, contract.Address)
+			if err != nil {
+				failures = append(failures, fmt.Errorf("[%s] %s: failed to get code at %s: %w", network.Name, contract.Name, contract.Address, err))
+			} else if !hasCode {
+				failures = append(failures, fmt.Errorf("[%s] %s: no contract code at %s, check the address and network", network.Name, contract.Name, contract.Address))
+			}
+
+			var count int64
+			if err := db.WithContext(ctx).Model(&config.SyncState{}).Where("contract_address = ?", contract.Address).Count(&count).Error; err != nil {
+				failures = append(failures, fmt.Errorf("[%s] %s: failed to read sync state: %w", network.Name, contract.Name, err))
+			} else if count == 0 {
+				failures = append(failures, fmt.Errorf("[%s] %s: no sync_states row for %s", network.Name, contract.Name, contract.Address))
+			}
+		}
+	}
+
+	return errors.Join(failures...)
+}
+
+func selfTestClient(ctx context.Context, cfg config.Config, clients map[string]*RPCClient, endpoint string) (*RPCClient, error) {
+	if client, ok := clients[endpoint]; ok {
+		return client, nil
+	}
+	client, err := NewRPCClient(endpoint, RPCOptionsFromConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	clients[endpoint] = client
+	if _, err := client.GetLatestBlockNumber(ctx); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,294 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/evaafi/go-indexer/config"
+	"github.com/glebarez/go-sqlite"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type EventSink interface {
+	Store(ctx context.Context, contract config.Contract, entities []interface{}) error
+}
+
+type EventRemover interface {
+	Remove(ctx context.Context, contract config.Contract, entities []interface{}) error
+}
+
+// CommitSink is a sink that may commit only part of a batch, later sinks only see the entities it returns.
+type CommitSink interface {
+	StoreCommitted(ctx context.Context, contract config.Contract, entities []interface{}) ([]interface{}, error)
+}
+
+type CatchUpListener interface {
+	CaughtUp(ctx context.Context, contract config.Contract)
+}
+
+type DBSink struct {
+	db *gorm.DB
+}
+
+func NewDBSink(db *gorm.DB) *DBSink {
+	return &DBSink{db: db}
+}
+
+func (s *DBSink) Store(ctx context.Context, contract config.Contract, entities []interface{}) error {
+	_, err := s.StoreCommitted(ctx, contract, entities)
+	return err
+}
+
+func (s *DBSink) StoreCommitted(ctx context.Context, contract config.Contract, entities []interface{}) ([]interface{}, error) {
+	err := s.store(ctx, contract, entities)
+	if err == nil {
+		return entities, nil
+	}
+
+	fmt.Printf("Warning: [%s] batch insert failed, retrying %d events one by one: %v\n", contract.Name, len(entities), err)
+	return s.storeEach(ctx, contract, entities)
+}
+
+func (s *DBSink) store(ctx context.Context, contract config.Contract, entities []interface{}) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		counts, err := newEntityCounts(tx, entities)
+		if err != nil {
+			return err
+		}
+		if err := storeEntities(tx, contract, entities); err != nil {
+			return err
+		}
+		if err := storeBlockEventStats(tx, contract.Address, counts); err != nil {
+			return fmt.Errorf("failed to store block event stats: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *DBSink) storeEach(ctx context.Context, contract config.Contract, entities []interface{}) ([]interface{}, error) {
+	stored := make([]interface{}, 0, len(entities))
+	for _, entity := range entities {
+		var insertErr error
+		// The stats increment commits with the row, a retried range would otherwise see the row and skip counting it.
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			counts, err := newEntityCounts(tx, []interface{}{entity})
+			if err != nil {
+				return err
+			}
+			if insertErr = insertEntities(tx, []interface{}{entity}); insertErr != nil {
+				return insertErr
+			}
+			if err := updateDerivedState(tx, contract, []interface{}{entity}); err != nil {
+				return err
+			}
+			if err := storeBlockEventStats(tx, contract.Address, counts); err != nil {
+				return fmt.Errorf("failed to store block event stats: %w", err)
+			}
+			return nil
+		})
+		if err == nil {
+			stored = append(stored, entity)
+			continue
+		}
+
+		// Only a row the database will never accept is dead-lettered, anything else retries the range.
+		if insertErr == nil || !isRejectedRow(insertErr) {
+			return nil, fmt.Errorf("failed to store %s: %w", eventTypeName(entity), err)
+		}
+		// If the dead letter can't be written either, the database itself is likely failing, so retry the range.
+		if dlErr := s.deadLetter(ctx, contract, entity, err); dlErr != nil {
+			return nil, fmt.Errorf("failed to store %s: %w (dead letter failed: %v)", eventTypeName(entity), err, dlErr)
+		}
+		fmt.Printf("Warning: [%s] moved %s at block %d to dead letters: %v\n", contract.Name, eventTypeName(entity), entityBlockNumber(entity), err)
+	}
+	return stored, nil
+}
+
+// isRejectedRow reports whether err is a constraint or data error, which fails the same way on every retry.
+// Deadlocks, serialization failures and lost connections are transient and not matched.
+func isRejectedRow(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1048, 1062, 1264, 1265, 1292, 1366, 1406, 1451, 1452, 3819:
+			return true
+		}
+		return false
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_CONSTRAINT, sqlite3.SQLITE_MISMATCH, sqlite3.SQLITE_TOOBIG:
+			return true
+		}
+	}
+	return false
+}
+
+func (s *DBSink) deadLetter(ctx context.Context, contract config.Contract, entity interface{}, cause error) error {
+	payload, err := json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", eventTypeName(entity), err)
+	}
+
+	return s.db.WithContext(ctx).Create(&config.DeadLetter{
+		ContractAddress: contract.Address,
+		EventType:       eventTypeName(entity),
+		EntityID:        entityID(entity),
+		BlockNumber:     int64(entityBlockNumber(entity)),
+		Payload:         string(payload),
+		Error:           cause.Error(),
+	}).Error
+}
+
+func (s *DBSink) Remove(ctx context.Context, contract config.Contract, entities []interface{}) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		counts := make(map[blockEventKey]int64)
+		for _, entity := range entities {
+			// The id repeats when a transaction is re-included, so the hash keeps the canonical copy.
+			result := unsafeRows(tx).Where("block_hash = ?", entityBlockHash(entity)).Delete(entity)
+			if result.Error != nil {
+				return fmt.Errorf("failed to delete %s: %w", eventTypeName(entity), result.Error)
+			}
+			if result.RowsAffected > 0 {
+				counts[blockEventKey{blockNumber: entityBlockNumber(entity), eventType: eventTypeName(entity)}] += result.RowsAffected
+			}
+		}
+		if err := decrementBlockEventStats(tx, contract.Address, counts); err != nil {
+			return err
+		}
+		if hasPauseEvents(entities) {
+			if err := rebuildContractStatus(tx, contract); err != nil {
+				return fmt.Errorf("failed to rebuild contract status: %w", err)
+			}
+		}
+		if hasOwnershipEvents(entities) {
+			if err := rebuildContractOwner(tx, contract); err != nil {
+				return fmt.Errorf("failed to rebuild contract owner: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+type MultiSink []EventSink
+
+func (m MultiSink) Store(ctx context.Context, contract config.Contract, entities []interface{}) error {
+	for _, sink := range m {
+		if committer, ok := sink.(CommitSink); ok {
+			committed, err := committer.StoreCommitted(ctx, contract, entities)
+			if err != nil {
+				return err
+			}
+			entities = committed
+			continue
+		}
+		if err := sink.Store(ctx, contract, entities); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MultiSink) Remove(ctx context.Context, contract config.Contract, entities []interface{}) error {
+	for _, sink := range m {
+		remover, ok := sink.(EventRemover)
+		if !ok {
+			continue
+		}
+		if err := remover.Remove(ctx, contract, entities); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MultiSink) CaughtUp(ctx context.Context, contract config.Contract) {
+	for _, sink := range m {
+		if listener, ok := sink.(CatchUpListener); ok {
+			listener.CaughtUp(ctx, contract)
+		}
+	}
+}
+
+type MemorySink struct {
+	mu       sync.Mutex
+	Entities []interface{}
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (m *MemorySink) Store(ctx context.Context, contract config.Contract, entities []interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Entities = append(m.Entities, entities...)
+	return nil
+}
+
+type DryRunSink struct{}
+
+func (DryRunSink) Store(ctx context.Context, contract config.Contract, entities []interface{}) error {
+	counts := make(map[string]int)
+	samples := make(map[string]interface{})
+	var order []string
+	for _, entity := range entities {
+		eventType := eventTypeName(entity)
+		if _, ok := samples[eventType]; !ok {
+			samples[eventType] = entity
+			order = append(order, eventType)
+		}
+		counts[eventType]++
+	}
+
+	for _, eventType := range order {
+		sample, err := json.Marshal(samples[eventType])
+		if err != nil {
+			sample = []byte(fmt.Sprintf("%+v", samples[eventType]))
+		}
+		fmt.Printf("[%s] Dry run: would insert %d %s events, sample: %s\n",
+			contract.Name, counts[eventType], eventType, sample)
+	}
+
+	return nil
+}
+
+func entityBlockHash(entity interface{}) string {
+	v := reflect.ValueOf(entity)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if f := v.FieldByName("BlockHash"); f.IsValid() && f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
+
+func entityBlockNumber(entity interface{}) uint64 {
+	v := reflect.ValueOf(entity)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+	if bn, ok := v.FieldByName("BlockNumber").Interface().(config.BigInt); ok {
+		return bn.Uint64()
+	}
+	return 0
+}
@@ -0,0 +1,188 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/evaafi/go-indexer/config"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestDBSinkStoreDeadLettersOnlyFailingEntity(t *testing.T) {
+	sink := statsTestDB(t)
+	contract := config.Contract{Name: "RebalancerDelegation", Address: "0x00000000000000000000000000000000000000aa"}
+
+	// Stands in for any constraint the database enforces on one event type.
+	if err := sink.db.Exec(`CREATE TRIGGER reject_operator BEFORE INSERT ON operator_addeds
+		WHEN NEW.operator = '0xbad' BEGIN SELECT RAISE(ABORT, 'operator rejected'); END`).Error; err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	entities := []interface{}{
+		testBet("bet-1", 10),
+		&config.OperatorAdded{ID: "op-bad", Operator: "0xbad", BlockNumber: config.NewBigInt(11), BlockTimestamp: config.NewBigInt(1), TransactionHash: "0xo1"},
+		&config.OperatorAdded{ID: "op-good", Operator: "0x03", BlockNumber: config.NewBigInt(11), BlockTimestamp: config.NewBigInt(1), TransactionHash: "0xo2"},
+		testBet("bet-2", 12),
+	}
+	if err := sink.Store(context.Background(), contract, entities); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	var bets, operators int64
+	sink.db.Model(&config.BetPlaced{}).Count(&bets)
+	sink.db.Model(&config.OperatorAdded{}).Where("id = ?", "op-good").Count(&operators)
+	if bets != 2 || operators != 1 {
+		t.Errorf("stored %d bets and %d valid operators, want 2 and 1", bets, operators)
+	}
+
+	var letters []config.DeadLetter
+	if err := sink.db.Find(&letters).Error; err != nil {
+		t.Fatalf("read dead letters: %v", err)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(letters))
+	}
+	letter := letters[0]
+	if letter.EntityID != "op-bad" || letter.EventType != "OperatorAdded" || letter.BlockNumber != 11 || letter.ContractAddress != contract.Address {
+		t.Errorf("unexpected dead letter: %+v", letter)
+	}
+
+	if blockEventCount(t, sink, contract, 10) != 1 || blockEventCount(t, sink, contract, 12) != 1 {
+		t.Error("bets stored one by one were not counted")
+	}
+	var operatorStats config.BlockEventStats
+	if err := sink.db.Where("block_number = ? AND event_type = ?", 11, "OperatorAdded").First(&operatorStats).Error; err != nil {
+		t.Fatalf("read operator stats: %v", err)
+	}
+	if operatorStats.Count != 1 {
+		t.Errorf("block 11 counted %d operators, want only the stored one", operatorStats.Count)
+	}
+}
+
+func TestMultiSinkForwardsOnlyCommittedEntities(t *testing.T) {
+	db := statsTestDB(t)
+	contract := config.Contract{Name: "RebalancerDelegation", Address: "0x00000000000000000000000000000000000000aa"}
+
+	if err := db.db.Exec(`CREATE TRIGGER reject_operator BEFORE INSERT ON operator_addeds
+		WHEN NEW.operator = '0xbad' BEGIN SELECT RAISE(ABORT, 'operator rejected'); END`).Error; err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	downstream := NewMemorySink()
+	good := &config.OperatorAdded{ID: "op-good", Operator: "0x03", BlockNumber: config.NewBigInt(11), BlockTimestamp: config.NewBigInt(1), TransactionHash: "0xo2"}
+	entities := []interface{}{
+		&config.OperatorAdded{ID: "op-bad", Operator: "0xbad", BlockNumber: config.NewBigInt(11), BlockTimestamp: config.NewBigInt(1), TransactionHash: "0xo1"},
+		good,
+	}
+	if err := (MultiSink{db, downstream}).Store(context.Background(), contract, entities); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	if len(downstream.Entities) != 1 || downstream.Entities[0] != good {
+		t.Errorf("downstream sink got %v, want only the committed operator", downstream.Entities)
+	}
+}
+
+func TestDBSinkStoreRetriesFailuresOtherThanRejectedRows(t *testing.T) {
+	sink := statsTestDB(t)
+	contract := config.Contract{Name: "ProtocolSelector", Address: "0x00000000000000000000000000000000000000aa"}
+
+	// The row inserts fine but its status update can't, which must not cost the event.
+	if err := sink.db.Migrator().DropTable(&config.ContractStatus{}); err != nil {
+		t.Fatalf("drop contract statuses: %v", err)
+	}
+	paused := &config.Paused{ID: "pause-1", Account: "0x01", BlockNumber: config.NewBigInt(10), BlockTimestamp: config.NewBigInt(1), TransactionHash: "0xp1"}
+	if err := sink.Store(context.Background(), contract, []interface{}{paused}); err == nil {
+		t.Fatal("store succeeded without a contract status table")
+	}
+
+	var letters, rows int64
+	sink.db.Model(&config.DeadLetter{}).Count(&letters)
+	sink.db.Model(&config.Paused{}).Count(&rows)
+	if letters != 0 || rows != 0 {
+		t.Errorf("got %d dead letters and %d paused rows, want the range left for a retry", letters, rows)
+	}
+}
+
+func TestIsRejectedRow(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"postgres unique violation", &pgconn.PgError{Code: "23505"}, true},
+		{"postgres numeric overflow", &pgconn.PgError{Code: "22003"}, true},
+		{"postgres serialization failure", &pgconn.PgError{Code: "40001"}, false},
+		{"postgres deadlock", &pgconn.PgError{Code: "40P01"}, false},
+		{"mysql data too long", &mysql.MySQLError{Number: 1406}, true},
+		{"mysql deadlock", &mysql.MySQLError{Number: 1213}, false},
+		{"mysql lock wait timeout", &mysql.MySQLError{Number: 1205}, false},
+		{"wrapped constraint", fmt.Errorf("failed to insert BetPlaced: %w", &pgconn.PgError{Code: "23502"}), true},
+		{"dropped connection", errors.New("driver: bad connection"), false},
+	}
+	for _, tt := range tests {
+		if got := isRejectedRow(tt.err); got != tt.want {
+			t.Errorf("%s: isRejectedRow = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDBSinkStoreEachCountsRowsAfterStatsFailure(t *testing.T) {
+	sink := statsTestDB(t)
+	contract := config.Contract{Name: "WhizyPredictionMarket", Address: "0x00000000000000000000000000000000000000aa"}
+	ctx := context.Background()
+
+	// The duplicate id fails the batch insert, so the bets are stored one by one.
+	batch := []interface{}{testBet("a", 10), testBet("a", 10), testBet("b", 10)}
+	if err := sink.db.Migrator().DropTable(&config.BlockEventStats{}); err != nil {
+		t.Fatalf("drop stats: %v", err)
+	}
+	if err := sink.Store(ctx, contract, batch); err == nil {
+		t.Fatal("store succeeded without a stats table")
+	}
+
+	if err := sink.db.AutoMigrate(&config.BlockEventStats{}); err != nil {
+		t.Fatalf("recreate stats: %v", err)
+	}
+	if err := sink.Store(ctx, contract, batch); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if got := blockEventCount(t, sink, contract, 10); got != 2 {
+		t.Errorf("block 10 count = %d after the retry, want 2", got)
+	}
+}
+
+func TestDBSinkRemoveKeepsCanonicalCopy(t *testing.T) {
+	sink := statsTestDB(t)
+	contract := config.Contract{Name: "WhizyPredictionMarket", Address: "0x00000000000000000000000000000000000000aa"}
+	ctx := context.Background()
+
+	canonical := testBet("a", 10)
+	canonical.BlockHash = "0xcanonical"
+	if err := sink.Store(ctx, contract, []interface{}{canonical}); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	// The orphaned block carried the same transaction, so its removed log has the same id.
+	orphaned := testBet("a", 10)
+	orphaned.BlockHash = "0xorphaned"
+	if err := sink.Remove(ctx, contract, []interface{}{orphaned}); err != nil {
+		t.Fatalf("remove orphaned: %v", err)
+	}
+	var count int64
+	sink.db.Model(&config.BetPlaced{}).Count(&count)
+	if count != 1 || blockEventCount(t, sink, contract, 10) != 1 {
+		t.Fatalf("removing the orphaned copy left %d bets, want the canonical one", count)
+	}
+
+	if err := sink.Remove(ctx, contract, []interface{}{canonical}); err != nil {
+		t.Fatalf("remove canonical: %v", err)
+	}
+	sink.db.Model(&config.BetPlaced{}).Count(&count)
+	if count != 0 || blockEventCount(t, sink, contract, 10) != 0 {
+		t.Errorf("removing the canonical copy left %d bets", count)
+	}
+}
@@ -0,0 +1,157 @@
+package indexer
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const statsLookupBatch = 500
+
+type blockEventKey struct {
+	blockNumber uint64
+	eventType   string
+}
+
+func eventTypeName(entity interface{}) string {
+	t := reflect.TypeOf(entity)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+func storeBlockEventStats(db *gorm.DB, contractAddress string, counts map[blockEventKey]int64) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	rows := make([]config.BlockEventStats, 0, len(counts))
+	for key, count := range counts {
+		rows = append(rows, config.BlockEventStats{
+			ContractAddress: contractAddress,
+			BlockNumber:     int64(key.blockNumber),
+			EventType:       key.eventType,
+			Count:           count,
+		})
+	}
+
+	// A block's events can arrive over several batches, so counts accumulate rather than replace.
+	sum := fmt.Sprintf("%s.count + excluded.count", config.GetTableName(db, &config.BlockEventStats{}))
+	if db.Dialector.Name() == "mysql" {
+		sum = "count + VALUES(count)"
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "contract_address"}, {Name: "block_number"}, {Name: "event_type"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr(sum)}),
+	}).Create(&rows).Error
+}
+
+// Replayed events already have a row, only entities stored for the first time add to the counts.
+func newEntityCounts(db *gorm.DB, entities []interface{}) (map[blockEventKey]int64, error) {
+	ids := make(map[reflect.Type][]string)
+	for _, entity := range entities {
+		t := reflect.TypeOf(entity)
+		ids[t] = append(ids[t], entityID(entity))
+	}
+
+	existing := make(map[reflect.Type]map[string]bool, len(ids))
+	for t, batch := range ids {
+		existing[t] = make(map[string]bool)
+		for start := 0; start < len(batch); start += statsLookupBatch {
+			end := min(start+statsLookupBatch, len(batch))
+			var found []string
+			if err := db.Model(reflect.New(t.Elem()).Interface()).Where("id IN ?", batch[start:end]).Pluck("id", &found).Error; err != nil {
+				return nil, fmt.Errorf("failed to look up stored %s: %w", t.Elem().Name(), err)
+			}
+			for _, id := range found {
+				existing[t][id] = true
+			}
+		}
+	}
+
+	counts := make(map[blockEventKey]int64)
+	for _, entity := range entities {
+		t, id := reflect.TypeOf(entity), entityID(entity)
+		if existing[t][id] {
+			continue
+		}
+		existing[t][id] = true
+		counts[blockEventKey{blockNumber: entityBlockNumber(entity), eventType: eventTypeName(entity)}]++
+	}
+	return counts, nil
+}
+
+func entityID(entity interface{}) string {
+	v := reflect.ValueOf(entity)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if f := v.FieldByName("ID"); f.IsValid() && f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
+
+func decrementBlockEventStats(db *gorm.DB, contractAddress string, counts map[blockEventKey]int64) error {
+	for key, count := range counts {
+		err := db.Model(&config.BlockEventStats{}).
+			Where("contract_address = ? AND block_number = ? AND event_type = ?", contractAddress, key.blockNumber, key.eventType).
+			Update("count", gorm.Expr("count - ?", count)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return db.Where("contract_address = ? AND count <= 0", contractAddress).Delete(&config.BlockEventStats{}).Error
+}
+
+func RebuildBlockEventStats(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&config.BlockEventStats{}).Error; err != nil {
+			return fmt.Errorf("failed to clear block event stats: %w", err)
+		}
+
+		for _, network := range config.CFG.IndexedNetworks() {
+			for _, contract := range config.NetworkContracts[network.Name] {
+				for _, model := range config.ContractTables[contract.Name] {
+					if err := rebuildEventTypeStats(tx, contract, model, networkScope(tx.Model(model), contract)); err != nil {
+						return err
+					}
+				}
+
+				// Raw events share one table across contracts, so they are counted by address.
+				raw := networkScope(tx.Model(&config.RawEvent{}).Where("contract_address = ?", contract.Address), contract)
+				if err := rebuildEventTypeStats(tx, contract, &config.RawEvent{}, raw); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func rebuildEventTypeStats(tx *gorm.DB, contract config.Contract, model interface{}, query *gorm.DB) error {
+	var rows []struct {
+		BlockNumber int64
+		Count       int64
+	}
+	err := query.Select("block_number, COUNT(*) AS count").
+		Group("block_number").
+		Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to aggregate %s: %w", eventTypeName(model), err)
+	}
+
+	counts := make(map[blockEventKey]int64, len(rows))
+	for _, row := range rows {
+		counts[blockEventKey{blockNumber: uint64(row.BlockNumber), eventType: eventTypeName(model)}] = row.Count
+	}
+	if err := storeBlockEventStats(tx, contract.Address, counts); err != nil {
+		return fmt.Errorf("failed to store %s stats: %w", eventTypeName(model), err)
+	}
+	return nil
+}
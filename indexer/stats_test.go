@@ -0,0 +1,147 @@
+package indexer
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/evaafi/go-indexer/config"
+)
+
+func statsTestDB(t *testing.T) *DBSink {
+	t.Helper()
+	models := append(config.EventTables(), &config.RawEvent{}, &config.BlockEventStats{}, &config.DeadLetter{},
+		&config.ContractStatus{}, &config.ContractOwner{})
+	return NewDBSink(openTestDB(t, models...))
+}
+
+func testBet(id string, block int64) *config.BetPlaced {
+	return &config.BetPlaced{
+		ID:              id,
+		MarketID:        config.BigInt{Int: big.NewInt(1)},
+		User:            "0x00000000000000000000000000000000000000bb",
+		Amount:          config.BigInt{Int: big.NewInt(5)},
+		Shares:          config.BigInt{Int: big.NewInt(5)},
+		BlockNumber:     config.BigInt{Int: big.NewInt(block)},
+		BlockTimestamp:  config.BigInt{Int: big.NewInt(1700000000)},
+		TransactionHash: "0x" + id,
+	}
+}
+
+func blockEventCount(t *testing.T, sink *DBSink, contract config.Contract, block int64) int64 {
+	t.Helper()
+	var stats []config.BlockEventStats
+	if err := sink.db.Where("contract_address = ? AND block_number = ? AND event_type = ?", contract.Address, block, "BetPlaced").
+		Find(&stats).Error; err != nil {
+		t.Fatalf("read stats: %v", err)
+	}
+	if len(stats) == 0 {
+		return 0
+	}
+	return stats[0].Count
+}
+
+func TestStoreBlockEventStatsAccumulatesNewRowsOnly(t *testing.T) {
+	sink := statsTestDB(t)
+	contract := config.Contract{Name: "WhizyPredictionMarket", Address: "0x00000000000000000000000000000000000000aa"}
+	ctx := context.Background()
+
+	if err := sink.Store(ctx, contract, []interface{}{testBet("a", 10), testBet("b", 10)}); err != nil {
+		t.Fatalf("first batch: %v", err)
+	}
+	// The second batch replays "b" and adds "c" to the same block.
+	if err := sink.Store(ctx, contract, []interface{}{testBet("b", 10), testBet("c", 10), testBet("d", 11)}); err != nil {
+		t.Fatalf("second batch: %v", err)
+	}
+	if got := blockEventCount(t, sink, contract, 10); got != 3 {
+		t.Errorf("block 10 count = %d, want 3", got)
+	}
+	if got := blockEventCount(t, sink, contract, 11); got != 1 {
+		t.Errorf("block 11 count = %d, want 1", got)
+	}
+}
+
+func TestRebuildBlockEventStatsScopesByNetwork(t *testing.T) {
+	saved, savedContracts := config.CFG, config.NetworkContracts
+	defer func() { config.CFG, config.NetworkContracts = saved, savedContracts }()
+
+	config.CFG.Networks = []config.NetworkEndpoint{{Name: "mainnet"}, {Name: "testnet"}}
+	mainnet := config.Contract{Name: "WhizyPredictionMarket", Address: "0x00000000000000000000000000000000000000aa", Network: "mainnet"}
+	testnet := config.Contract{Name: "WhizyPredictionMarket", Address: "0x00000000000000000000000000000000000000cc", Network: "testnet"}
+	config.NetworkContracts = map[string][]config.Contract{"mainnet": {mainnet}, "testnet": {testnet}}
+
+	sink := statsTestDB(t)
+	rows := []*config.BetPlaced{testBet("a", 10), testBet("b", 10), testBet("c", 10)}
+	rows[0].Network, rows[1].Network, rows[2].Network = "mainnet", "mainnet", "testnet"
+	if err := sink.db.Create(&rows).Error; err != nil {
+		t.Fatalf("insert bets: %v", err)
+	}
+
+	if err := RebuildBlockEventStats(sink.db); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if got := blockEventCount(t, sink, mainnet, 10); got != 2 {
+		t.Errorf("mainnet block 10 count = %d, want 2", got)
+	}
+	if got := blockEventCount(t, sink, testnet, 10); got != 1 {
+		t.Errorf("testnet block 10 count = %d, want 1", got)
+	}
+}
+
+func TestRebuildBlockEventStatsKeepsRawEvents(t *testing.T) {
+	saved, savedContracts := config.CFG, config.NetworkContracts
+	defer func() { config.CFG, config.NetworkContracts = saved, savedContracts }()
+
+	contract := config.Contract{Name: "WhizyPredictionMarket", Address: "0x00000000000000000000000000000000000000aa"}
+	other := config.Contract{Name: "ProtocolSelector", Address: "0x00000000000000000000000000000000000000cc"}
+	config.CFG.Networks = nil
+	config.NetworkContracts = map[string][]config.Contract{config.CFG.IndexedNetworks()[0].Name: {contract, other}}
+
+	sink := statsTestDB(t)
+	raw := &config.RawEvent{ID: "0xraw-0", ContractAddress: contract.Address, Topics: "", Data: "0x",
+		BlockNumber: config.NewBigInt(12), BlockTimestamp: config.NewBigInt(1), TransactionHash: "0xraw"}
+	if err := sink.Store(context.Background(), contract, []interface{}{testBet("a", 12), raw}); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	if err := RebuildBlockEventStats(sink.db); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	var stats []config.BlockEventStats
+	if err := sink.db.Where("event_type = ?", "RawEvent").Find(&stats).Error; err != nil {
+		t.Fatalf("read stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].ContractAddress != contract.Address || stats[0].BlockNumber != 12 || stats[0].Count != 1 {
+		t.Errorf("raw event stats after rebuild = %+v, want one row for block 12 of %s", stats, contract.Name)
+	}
+	if got := blockEventCount(t, sink, contract, 12); got != 1 {
+		t.Errorf("block 12 bet count = %d, want 1", got)
+	}
+}
+
+func TestDeleteEventsFromBlockKeepsFinalizedCounts(t *testing.T) {
+	saved, savedContracts := config.CFG, config.Contracts
+	defer func() { config.CFG, config.Contracts = saved, savedContracts }()
+
+	contract := config.Contract{Name: "WhizyPredictionMarket", Address: "0x00000000000000000000000000000000000000aa"}
+	config.Contracts = []config.Contract{contract}
+	config.CFG.Confirmations = 5
+
+	sink := statsTestDB(t)
+	if err := sink.Store(context.Background(), contract, []interface{}{testBet("a", 10), testBet("b", 10), testBet("c", 11)}); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if err := sink.db.Model(&config.BetPlaced{}).Where("id = ?", "a").Update("finalized", true).Error; err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+
+	if _, err := DeleteEventsFromBlock(sink.db, contract.Address, 10); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := blockEventCount(t, sink, contract, 10); got != 1 {
+		t.Errorf("block 10 count = %d, want the finalized bet only", got)
+	}
+	if got := blockEventCount(t, sink, contract, 11); got != 0 {
+		t.Errorf("block 11 count = %d, want 0", got)
+	}
+}
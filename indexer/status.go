@@ -0,0 +1,63 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+)
+
+func PrintSyncStatus(ctx context.Context, cfg config.Config, db *gorm.DB, w io.Writer, maxLag uint64) (bool, error) {
+	networks := cfg.IndexedNetworks()
+	latestBlocks := make(map[string]uint64)
+	for _, network := range networks {
+		latestBlock, err := latestNetworkBlock(ctx, cfg, network)
+		if err != nil {
+			return false, fmt.Errorf("failed to get latest block for network %s: %w", network.Name, err)
+		}
+		latestBlocks[network.Name] = latestBlock
+	}
+
+	var states []config.SyncState
+	if err := db.Order("contract_name").Find(&states).Error; err != nil {
+		return false, fmt.Errorf("failed to read sync states: %w", err)
+	}
+
+	healthy := true
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NETWORK\tCONTRACT\tADDRESS\tLAST BLOCK\tLATEST BLOCK\tLAG")
+	for _, state := range states {
+		network := state.Network
+		if network == "" {
+			network = networks[0].Name
+		}
+		latestBlock, ok := latestBlocks[network]
+		if !ok {
+			continue
+		}
+
+		var lag uint64
+		if latestBlock > uint64(state.LastBlock) {
+			lag = latestBlock - uint64(state.LastBlock)
+		}
+		if maxLag > 0 && lag > maxLag {
+			healthy = false
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\n", network, state.ContractName, state.ContractAddress, state.LastBlock, latestBlock, lag)
+	}
+
+	return healthy, tw.Flush()
+}
+
+func latestNetworkBlock(ctx context.Context, cfg config.Config, network config.NetworkEndpoint) (uint64, error) {
+	rpcClient, err := NewRPCClient(network.RPCEndpoint, RPCOptionsFromConfig(cfg))
+	if err != nil {
+		return 0, err
+	}
+	defer rpcClient.Close()
+
+	return rpcClient.GetLatestBlockNumber(ctx)
+}
@@ -0,0 +1,95 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+)
+
+var errUnexpectedExit = errors.New("indexer loop returned before shutdown")
+
+const supervisorHealthyRun = 10 * time.Minute
+
+func superviseContract(ctx context.Context, cfg config.Config, contract config.Contract, run func() error) {
+	restarts := 0
+	for {
+		setContractState(contract, contractRunning)
+		started := time.Now()
+		err := runRecovered(contract, run)
+
+		if shuttingDown(ctx) {
+			setContractState(contract, contractStopped)
+			return
+		}
+		if errors.Is(err, ErrReorgTooDeep) {
+			setContractState(contract, contractHalted)
+			dropCatchUp(contract)
+			return
+		}
+		if err == nil {
+			err = errUnexpectedExit
+		}
+
+		// A run that lasted this long counts as healthy, so the next crash starts the backoff over.
+		if time.Since(started) >= supervisorHealthyRun {
+			restarts = 0
+		}
+		restarts++
+		contractRestarts.Add(contract.Name, 1)
+
+		if cfg.MaxContractRestarts > 0 && restarts > cfg.MaxContractRestarts {
+			setContractState(contract, contractFailed)
+			dropCatchUp(contract)
+			fmt.Printf("FATAL: [%s] indexer for %s crashed %d times in a row, giving up: %v\n", contract.Name, contract.Address, restarts, err)
+			return
+		}
+
+		delay := backoffDelay(restarts)
+		setContractState(contract, contractRestarting)
+		fmt.Printf("ERROR: [%s] indexer for %s crashed: %v, restarting in %s (restart %d)\n", contract.Name, contract.Address, err, delay, restarts)
+
+		// Uncommitted ranges are fetched again from sync_states, so their buffered events would be stored twice.
+		discardBuffer(contract)
+		if !sleepOrShutdown(ctx, delay) {
+			setContractState(contract, contractStopped)
+			return
+		}
+	}
+}
+
+func runRecovered(contract config.Contract, run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("PANIC: [%s] %v\n%s", contract.Name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run()
+}
+
+func shuttingDown(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	select {
+	case <-Shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+func sleepOrShutdown(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	case <-Shutdown:
+		return false
+	}
+}
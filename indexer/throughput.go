@@ -0,0 +1,115 @@
+package indexer
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+)
+
+type throughputSample struct {
+	at     time.Time
+	blocks uint64
+	events uint64
+}
+
+type throughputRate struct {
+	BlocksPerSecond float64 `json:"blocksPerSecond"`
+	EventsPerSecond float64 `json:"eventsPerSecond"`
+}
+
+var throughput = struct {
+	sync.Mutex
+	started time.Time
+	samples map[string][]throughputSample
+}{started: time.Now(), samples: make(map[string][]throughputSample)}
+
+func init() {
+	expvar.Publish("throughput", expvar.Func(func() interface{} {
+		return throughputRates(time.Now())
+	}))
+}
+
+func recordThroughput(contract config.Contract, blocks, events uint64) {
+	now := time.Now()
+
+	throughput.Lock()
+	defer throughput.Unlock()
+
+	key := contract.Name
+	if len(config.CFG.Networks) > 0 {
+		key = contract.Network + "/" + contract.Name
+	}
+	samples := append(throughput.samples[key], throughputSample{at: now, blocks: blocks, events: events})
+	throughput.samples[key] = pruneThroughputSamples(samples, now)
+}
+
+func pruneThroughputSamples(samples []throughputSample, now time.Time) []throughputSample {
+	cutoff := now.Add(-config.CFG.ThroughputWindow)
+	i := 0
+	for i < len(samples) && samples[i].at.Before(cutoff) {
+		i++
+	}
+	return samples[i:]
+}
+
+func throughputRates(now time.Time) map[string]throughputRate {
+	throughput.Lock()
+	defer throughput.Unlock()
+
+	// Until a full window has passed, divide by the time since startup so early readings aren't understated.
+	window := config.CFG.ThroughputWindow
+	if elapsed := now.Sub(throughput.started); elapsed < window {
+		window = elapsed
+	}
+
+	rates := make(map[string]throughputRate, len(throughput.samples))
+	for name, samples := range throughput.samples {
+		samples = pruneThroughputSamples(samples, now)
+		throughput.samples[name] = samples
+
+		var blocks, events uint64
+		for _, sample := range samples {
+			blocks += sample.blocks
+			events += sample.events
+		}
+		if window <= 0 {
+			rates[name] = throughputRate{}
+			continue
+		}
+		rates[name] = throughputRate{
+			BlocksPerSecond: float64(blocks) / window.Seconds(),
+			EventsPerSecond: float64(events) / window.Seconds(),
+		}
+	}
+	return rates
+}
+
+func reportThroughput(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-Shutdown:
+			return
+		case <-ticker.C:
+			rates := throughputRates(time.Now())
+			names := make([]string, 0, len(rates))
+			for name := range rates {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("Throughput %s: %.2f blocks/s, %.2f events/s (last %s)\n",
+					name, rates[name].BlocksPerSecond, rates[name].EventsPerSecond, config.CFG.ThroughputWindow)
+			}
+		}
+	}
+}
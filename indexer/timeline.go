@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var timelineColumns = []string{"user", "operator", "account"}
+
+type TimelineEntry struct {
+	EventType       string        `json:"eventType"`
+	Roles           []string      `json:"roles"`
+	BlockNumber     config.BigInt `json:"blockNumber"`
+	LogIndex        uint          `json:"logIndex"`
+	BlockTimestamp  config.BigInt `json:"blockTimestamp"`
+	TransactionHash string        `json:"transactionHash"`
+	Event           interface{}   `json:"event"`
+}
+
+func GetUserTimeline(db *gorm.DB, address string, fromBlock, toBlock uint64) ([]TimelineEntry, error) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if address == "" {
+		return nil, fmt.Errorf("empty address")
+	}
+
+	// Each table is queried on its own and merged here, the event tables share no column layout a UNION could use.
+	var timeline []TimelineEntry
+	for _, model := range config.EventTables() {
+		t := reflect.TypeOf(model).Elem()
+		columns := modelColumns(t, timelineColumns)
+		if len(columns) == 0 {
+			continue
+		}
+
+		matches := make([]clause.Expression, 0, len(columns))
+		for _, column := range columns {
+			matches = append(matches, clause.Eq{Column: clause.Column{Name: column}, Value: address})
+		}
+		q := db.Model(model).Where(clause.Or(matches...))
+		if fromBlock > 0 {
+			q = q.Where("block_number >= ?", fromBlock)
+		}
+		if toBlock > 0 {
+			q = q.Where("block_number <= ?", toBlock)
+		}
+		if config.CFG.Environment != "" {
+			q = q.Where("environment = ?", config.CFG.Environment)
+		}
+
+		rows := reflect.New(reflect.SliceOf(t))
+		if err := q.Find(rows.Interface()).Error; err != nil {
+			return nil, fmt.Errorf("failed to load %s for %s: %w", t.Name(), address, err)
+		}
+		for i := 0; i < rows.Elem().Len(); i++ {
+			row := rows.Elem().Index(i)
+			timeline = append(timeline, TimelineEntry{
+				EventType:       t.Name(),
+				Roles:           matchedRoles(row, columns, address),
+				BlockNumber:     row.FieldByName("BlockNumber").Interface().(config.BigInt),
+				LogIndex:        row.FieldByName("LogIndex").Interface().(uint),
+				BlockTimestamp:  row.FieldByName("BlockTimestamp").Interface().(config.BigInt),
+				TransactionHash: row.FieldByName("TransactionHash").String(),
+				Event:           row.Addr().Interface(),
+			})
+		}
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool {
+		if c := timeline[i].BlockNumber.Cmp(timeline[j].BlockNumber); c != 0 {
+			return c < 0
+		}
+		return timeline[i].LogIndex < timeline[j].LogIndex
+	})
+	return timeline, nil
+}
+
+func modelColumns(t reflect.Type, wanted []string) []string {
+	var columns []string
+	for _, name := range wanted {
+		for i := 0; i < t.NumField(); i++ {
+			if schema.ParseTagSetting(t.Field(i).Tag.Get("gorm"), ";")["COLUMN"] == name {
+				columns = append(columns, name)
+				break
+			}
+		}
+	}
+	return columns
+}
+
+func matchedRoles(row reflect.Value, columns []string, address string) []string {
+	var roles []string
+	for i := 0; i < row.NumField(); i++ {
+		column := schema.ParseTagSetting(row.Type().Field(i).Tag.Get("gorm"), ";")["COLUMN"]
+		for _, c := range columns {
+			if c == column && strings.EqualFold(row.Field(i).String(), address) {
+				roles = append(roles, column)
+			}
+		}
+	}
+	return roles
+}
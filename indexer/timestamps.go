@@ -0,0 +1,61 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/evaafi/go-indexer/config"
+)
+
+type TimestampProvider interface {
+	GetBlockTimestamp(ctx context.Context, blockNum uint64) (uint64, error)
+}
+
+type EstimatedTimestamps struct {
+	AnchorBlock uint64
+	AnchorTime  uint64
+	BlockTime   time.Duration
+}
+
+func (e EstimatedTimestamps) GetBlockTimestamp(ctx context.Context, blockNum uint64) (uint64, error) {
+	offset := (int64(blockNum) - int64(e.AnchorBlock)) * int64(e.BlockTime) / int64(time.Second)
+	if int64(e.AnchorTime)+offset < 0 {
+		return 0, fmt.Errorf("estimated timestamp for block %d is before the epoch", blockNum)
+	}
+	return uint64(int64(e.AnchorTime) + offset), nil
+}
+
+func (r *RPCClient) SetTimestampProvider(provider TimestampProvider) {
+	r.timestampProvider = provider
+}
+
+func (r *RPCClient) blockTimestamp(ctx context.Context, blockNum uint64) (uint64, error) {
+	if r.timestampProvider != nil {
+		return r.timestampProvider.GetBlockTimestamp(ctx, blockNum)
+	}
+	return r.GetBlockTimestamp(ctx, blockNum)
+}
+
+func configureTimestampProvider(ctx context.Context, cfg config.Config, rpcClient *RPCClient) error {
+	if cfg.TimestampSource != config.TimestampSourceEstimate {
+		return nil
+	}
+
+	// One header anchors the estimate, every other timestamp is computed from the block distance.
+	latest, err := rpcClient.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get latest block: %w", err)
+	}
+	header, err := rpcClient.GetBlockWithTimestamp(ctx, latest)
+	if err != nil {
+		return fmt.Errorf("failed to get anchor block %d: %w", latest, err)
+	}
+
+	rpcClient.SetTimestampProvider(EstimatedTimestamps{
+		AnchorBlock: latest,
+		AnchorTime:  header.Time,
+		BlockTime:   cfg.EstimatedBlockTime,
+	})
+	return nil
+}
@@ -0,0 +1,92 @@
+package indexer
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/evaafi/go-indexer/config"
+)
+
+func EventSignature(contractName, eventName string) (common.Hash, bool) {
+	signature, ok := eventSignatures[contractName][eventName]
+	return signature, ok
+}
+
+func warnUnknownEventStartBlocks(contracts []config.Contract) {
+	for _, contract := range contracts {
+		for name := range contract.EventStartBlocks {
+			if _, ok := EventSignature(contract.Name, name); !ok {
+				fmt.Printf("Warning: eventStartBlocks for %s references unknown event %s\n", contract.Name, name)
+			}
+		}
+	}
+}
+
+func ValidateEventFilter(cfg config.Config) error {
+	known := make(map[string]bool)
+	for _, signatures := range eventSignatures {
+		for name := range signatures {
+			known[name] = true
+		}
+	}
+	for _, layouts := range anonymousParsers {
+		for _, layout := range layouts {
+			known[layout.name] = true
+		}
+	}
+
+	for _, name := range append(append([]string{}, cfg.IncludeEvents...), cfg.ExcludeEvents...) {
+		if !known[name] {
+			return fmt.Errorf("unknown event type %q in includeEvents/excludeEvents", name)
+		}
+	}
+	return nil
+}
+
+func eventStored(contract config.Contract, name string, blockNumber uint64) bool {
+	if startBlock, ok := contract.EventStartBlocks[name]; ok && blockNumber < startBlock {
+		return false
+	}
+	return eventAllowed(name)
+}
+
+func eventAllowed(name string) bool {
+	if len(config.CFG.IncludeEvents) > 0 {
+		return slices.Contains(config.CFG.IncludeEvents, name)
+	}
+	return !slices.Contains(config.CFG.ExcludeEvents, name)
+}
+
+func logTopics(contract config.Contract, toBlock uint64) ([]common.Hash, bool) {
+	// Anonymous events can carry anything in topic0, so they can only be fetched without a topic filter.
+	if hasAnonymousParsers(contract.Name) {
+		return nil, true
+	}
+
+	excluded := make(map[common.Hash]bool)
+	for name, startBlock := range contract.EventStartBlocks {
+		if signature, ok := EventSignature(contract.Name, name); ok && startBlock > toBlock {
+			excluded[signature] = true
+		}
+	}
+	// includeEvents and excludeEvents are applied when storing, narrowing the query would hide unknown signatures.
+	if len(excluded) == 0 {
+		return nil, true
+	}
+
+	var topics []common.Hash
+	for _, versions := range parsers[contract.Name] {
+		for signature := range versions {
+			if !excluded[signature] {
+				topics = append(topics, signature)
+			}
+		}
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		return topics[i].Cmp(topics[j]) < 0
+	})
+
+	return topics, len(topics) > 0
+}
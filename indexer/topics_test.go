@@ -0,0 +1,79 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/evaafi/go-indexer/config"
+)
+
+func TestEventFiltersApplyAtStoreTime(t *testing.T) {
+	saved := config.CFG
+	defer func() { config.CFG = saved }()
+	config.CFG.IncludeEvents = []string{"BetPlaced", "MarketCreated"}
+
+	contract := benchContract("WhizyPredictionMarket")
+	contract.EventStartBlocks = map[string]uint64{"MarketCreated": 20}
+	signatures := eventSignatures[contract.Name]
+
+	logs := []types.Log{
+		benchLog("BetPlaced", signatures["BetPlaced"], 0),
+		benchLog("MarketCreated", signatures["MarketCreated"], 1),
+		benchLog("MarketResolved", signatures["MarketResolved"], 2),
+		benchLog("Unknown", common.HexToHash("0xdead"), 3),
+		benchLog("MarketCreated", signatures["MarketCreated"], 0),
+	}
+	logs[4].BlockNumber = 20
+	for i := range logs[:4] {
+		logs[i].BlockNumber = 10
+	}
+
+	rpcClient := &RPCClient{timestamps: newTimestampCache(4)}
+	rpcClient.timestamps.Add(10, 1)
+	rpcClient.timestamps.Add(20, 2)
+
+	sink := NewMemorySink()
+	if err := processLogs(context.Background(), sink, rpcClient, contract, 10, 20, logs, false); err != nil {
+		t.Fatalf("processLogs: %v", err)
+	}
+
+	var got []string
+	for _, entity := range sink.Entities {
+		got = append(got, eventTypeName(entity))
+	}
+	want := []string{"BetPlaced", "RawEvent", "MarketCreated"}
+	if len(got) != len(want) {
+		t.Fatalf("stored %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("stored %v, want %v", got, want)
+			break
+		}
+	}
+	if created := sink.Entities[2].(*config.MarketCreated); created.BlockNumber.Uint64() != 20 {
+		t.Errorf("MarketCreated stored from block %d, want only the one at its start block", created.BlockNumber.Uint64())
+	}
+}
+
+func TestLogTopicsNarrowBeforeEventStartBlock(t *testing.T) {
+	contract := benchContract("WhizyPredictionMarket")
+	contract.EventStartBlocks = map[string]uint64{"MarketCreated": 20}
+	created := eventSignatures[contract.Name]["MarketCreated"]
+
+	topics, ok := logTopics(contract, 19)
+	if !ok || len(topics) == 0 {
+		t.Fatalf("logTopics before the start block = %v, %v", topics, ok)
+	}
+	for _, topic := range topics {
+		if topic == created {
+			t.Error("range before MarketCreated's start block still queries its signature")
+		}
+	}
+
+	if topics, ok := logTopics(contract, 20); !ok || topics != nil {
+		t.Errorf("range reaching the start block narrowed the query to %v", topics)
+	}
+}
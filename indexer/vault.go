@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/evaafi/go-indexer/config"
+	"gorm.io/gorm"
+)
+
+type MarketVaultActivity struct {
+	MarketID     config.BigInt                  `json:"marketId"`
+	Question     string                         `json:"question"`
+	VaultAddress string                         `json:"vaultAddress"`
+	TokenAddress string                         `json:"tokenAddress"`
+	Count        int                            `json:"count"`
+	TotalAmount  config.BigInt                  `json:"totalAmount"`
+	Rebalances   []config.MarketVaultRebalanced `json:"rebalances"`
+}
+
+type vaultRebalanceRow struct {
+	config.MarketVaultRebalanced
+	Question     string
+	VaultAddress string
+	TokenAddress string
+}
+
+func GetMarketVaultActivity(db *gorm.DB, marketID string) ([]MarketVaultActivity, error) {
+	rebalances := config.GetTableName(db, &config.MarketVaultRebalanced{})
+	markets := config.GetTableName(db, &config.MarketCreated{})
+
+	join := fmt.Sprintf("LEFT JOIN %[1]s m ON m.market_id = r.market_id AND m.network = r.network", markets)
+	if config.CFG.Environment != "" {
+		join += " AND m.environment = r.environment"
+	}
+	q := db.Table(rebalances + " r").
+		Select("r.*, m.question, m.vault_address, m.token_address").
+		Joins(join)
+	if marketID != "" {
+		var id config.BigInt
+		if err := id.UnmarshalText([]byte(marketID)); err != nil {
+			return nil, fmt.Errorf("invalid market: %w", err)
+		}
+		q = q.Where("r.market_id = ?", id)
+	}
+	if config.CFG.Environment != "" {
+		q = q.Where("r.environment = ?", config.CFG.Environment)
+	}
+
+	var rows []vaultRebalanceRow
+	if err := q.Order("r.block_number, r.log_index").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load market vault rebalances: %w", err)
+	}
+
+	// Amounts are summed here rather than in SQL, SQLite would sum the NUMERIC text columns as floats.
+	var activity []MarketVaultActivity
+	index := make(map[string]int)
+	for _, row := range rows {
+		key := row.MarketID.String()
+		i, ok := index[key]
+		if !ok {
+			i = len(activity)
+			index[key] = i
+			activity = append(activity, MarketVaultActivity{
+				MarketID:     row.MarketID,
+				Question:     row.Question,
+				VaultAddress: row.VaultAddress,
+				TokenAddress: row.TokenAddress,
+				TotalAmount:  config.NewBigInt(0),
+			})
+		}
+		activity[i].Count++
+		activity[i].TotalAmount = activity[i].TotalAmount.Add(row.Amount)
+		activity[i].Rebalances = append(activity[i].Rebalances, row.MarketVaultRebalanced)
+	}
+	return activity, nil
+}
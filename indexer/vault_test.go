@@ -0,0 +1,100 @@
+package indexer
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/evaafi/go-indexer/config"
+)
+
+const marketVaultRebalancedABI = `[{"type":"event","name":"MarketVaultRebalanced","anonymous":false,"inputs":[
+	{"name":"marketId","type":"uint256","indexed":true},
+	{"name":"amount","type":"uint256","indexed":false}]}]`
+
+func marketVaultRebalancedLog(t *testing.T, marketID, amount *big.Int, block uint64, index uint) types.Log {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(marketVaultRebalancedABI))
+	if err != nil {
+		t.Fatalf("parse abi: %v", err)
+	}
+	event := parsed.Events["MarketVaultRebalanced"]
+	if event.ID != MarketVaultRebalancedSignature {
+		t.Fatalf("abi signature %s does not match %s", event.ID, MarketVaultRebalancedSignature)
+	}
+	data, err := event.Inputs.NonIndexed().Pack(amount)
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	return types.Log{
+		Address:     common.BigToAddress(big.NewInt(1)),
+		Topics:      []common.Hash{event.ID, common.BigToHash(marketID)},
+		Data:        data,
+		BlockNumber: block,
+		BlockHash:   common.BigToHash(big.NewInt(int64(block))),
+		TxHash:      common.BigToHash(big.NewInt(int64(block)*100 + int64(index))),
+		Index:       index,
+	}
+}
+
+func TestMarketVaultRebalancedFromABIEncodedLog(t *testing.T) {
+	saved := config.CFG
+	defer func() { config.CFG = saved }()
+	config.CFG.Environment = ""
+
+	contract := benchContract("WhizyPredictionMarket")
+	marketID := big.NewInt(42)
+	// Wider than 64 bits, so both the parser and the total keep full precision.
+	large, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	var entities []interface{}
+	for i, amount := range []*big.Int{large, big.NewInt(10)} {
+		entity, err := ParseContractLog(contract, marketVaultRebalancedLog(t, marketID, amount, uint64(100+i), 0), 1700000000)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		rebalance, ok := entity.(*config.MarketVaultRebalanced)
+		if !ok {
+			t.Fatalf("parsed %T, want *config.MarketVaultRebalanced", entity)
+		}
+		if rebalance.MarketID.Int64() != 42 || rebalance.Amount.Int.Cmp(amount) != 0 {
+			t.Fatalf("parsed market %s amount %s, want 42 and %s", rebalance.MarketID, rebalance.Amount, amount)
+		}
+		entities = append(entities, rebalance)
+	}
+	entities = append(entities, &config.MarketCreated{
+		ID:              "market-42",
+		MarketID:        config.BigInt{Int: marketID},
+		Question:        "Will it rain?",
+		EndTime:         config.NewBigInt(1800000000),
+		TokenAddress:    "0x01",
+		VaultAddress:    "0x02",
+		BlockNumber:     config.NewBigInt(90),
+		BlockTimestamp:  config.NewBigInt(1700000000),
+		TransactionHash: "0xm",
+	})
+
+	db := statsTestDB(t).db
+	if err := storeEntities(db, contract, entities); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	activity, err := GetMarketVaultActivity(db, "42")
+	if err != nil {
+		t.Fatalf("activity: %v", err)
+	}
+	if len(activity) != 1 {
+		t.Fatalf("got %d markets, want 1", len(activity))
+	}
+	want := new(big.Int).Add(large, big.NewInt(10))
+	got := activity[0]
+	if got.Count != 2 || got.TotalAmount.Int.Cmp(want) != 0 || got.Question != "Will it rain?" || got.VaultAddress != "0x02" {
+		t.Errorf("unexpected activity: count %d, total %s, question %q, vault %q", got.Count, got.TotalAmount, got.Question, got.VaultAddress)
+	}
+	if len(got.Rebalances) != 2 || got.Rebalances[0].Amount.Int.Cmp(large) != 0 {
+		t.Errorf("rebalances not in block order: %+v", got.Rebalances)
+	}
+}
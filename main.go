@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
+	_ "embed"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	_ "net/http/pprof"
 	"os"
 	"os/signal"
 	"strings"
@@ -14,13 +19,60 @@ import (
 	"github.com/evaafi/go-indexer/indexer"
 )
 
+//go:embed networks.json
+var defaultNetworks []byte
+
 func main() {
-	cfg, err := config.LoadConfig("config.yaml")
+	configPath := flag.String("config", "config.yaml", "path to the config file")
+	maxLag := flag.Uint64("max-lag", 0, "status: exit non-zero if any contract lags more than this many blocks")
+	startBlock := flag.String("start-block", "", "override the start block, either N for all contracts or Name=N,... per contract; resets existing sync state")
+	exportTable := flag.String("table", "", "export: event table to export, e.g. bet_placeds")
+	exportFrom := flag.Uint64("from-block", 0, "export, reconcile: first block to include")
+	exportTo := flag.Uint64("to-block", 0, "export, reconcile: last block to include")
+	exportMarket := flag.String("market", "", "export: only include rows for this market id")
+	exportOut := flag.String("out", "", "export: output file, defaults to stdout")
+	abiSources := flag.String("abi", "", "verify-abi: ABI file or URL per contract, as Name=path,...")
+	storeTx := flag.Bool("store", false, "reprocess-tx: store the decoded entities instead of only printing them")
+	flag.Parse()
+
+	// The spec only depends on the models, so it is written before any config output could mix into it.
+	if flag.Arg(0) == "openapi" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(indexer.OpenAPISpec()); err != nil {
+			fmt.Printf("Failed to write OpenAPI spec: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	config.DefaultNetworks = defaultNetworks
+	cfg, err := config.LoadConfig(*configPath)
 	config.CFG = cfg
 
 	if err != nil {
 		panic(fmt.Sprintf("Cant connect to database: %v", err))
 	}
+	if err := indexer.ValidateEventFilter(cfg); err != nil {
+		panic(fmt.Sprintf("Invalid event filter: %v", err))
+	}
+
+	if flag.Arg(0) == "verify-abi" {
+		sources, err := indexer.ParseABISources(*abiSources)
+		if err != nil {
+			fmt.Printf("Invalid -abi: %v\n", err)
+			os.Exit(1)
+		}
+		matched, err := indexer.VerifyABIs(os.Stdout, sources)
+		if err != nil {
+			fmt.Printf("Failed to verify ABIs: %v\n", err)
+			os.Exit(1)
+		}
+		if !matched {
+			os.Exit(2)
+		}
+		return
+	}
 
 	db, err := config.GetDBInstance()
 	if err != nil {
@@ -33,6 +85,7 @@ func main() {
 		&config.MarketResolved{},
 		&config.WinningsClaimed{},
 		&config.MarketVaultRebalanced{},
+		&config.BatchRebalanced{},
 		&config.AutoDepositExecuted{},
 		&config.AutoWithdrawExecuted{},
 		&config.OwnershipTransferred{},
@@ -47,9 +100,112 @@ func main() {
 		&config.Rebalanced{},
 		&config.OperatorAdded{},
 		&config.OperatorRemoved{},
+		&config.RawEvent{},
+		&config.BlockEventStats{},
+		&config.QueuedEntity{},
+		&config.DeadLetter{},
+		&config.ScannedRange{},
+		&config.ContractStatus{},
+		&config.ContractOwner{},
 		&config.SyncState{},
 	}
 
+	if flag.Arg(0) == "status" {
+		healthy, err := indexer.PrintSyncStatus(context.Background(), cfg, db, os.Stdout, *maxLag)
+		if err != nil {
+			fmt.Printf("Failed to get sync status: %v\n", err)
+			os.Exit(1)
+		}
+		if !healthy {
+			os.Exit(2)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "migrate-ids" {
+		// Rows without a network would be skipped by the per-network rewrite.
+		if err := config.AssignDefaultNetwork(db, cfg.NetworkNames()[0]); err != nil {
+			panic(fmt.Sprintf("Failed to assign default network: %v", err))
+		}
+		counts, err := config.MigrateEventIDs(db, cfg.IDFormat, cfg.IndexedNetworks())
+		if err != nil {
+			panic(fmt.Sprintf("Failed to migrate event ids: %v", err))
+		}
+		for table, count := range counts {
+			fmt.Printf("Rewrote %d ids in %s\n", count, table)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "reconcile" {
+		matched, err := indexer.Reconcile(context.Background(), cfg, db, os.Stdout, *exportFrom, *exportTo)
+		if err != nil {
+			fmt.Printf("Failed to reconcile events: %v\n", err)
+			os.Exit(1)
+		}
+		if !matched {
+			os.Exit(2)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "reparse" {
+		result, err := indexer.ReparseRawEvents(context.Background(), db)
+		if err != nil {
+			fmt.Printf("Failed to reparse raw events: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Reparsed raw events: %d decoded, %d still unknown, %d failed\n", result.Decoded, result.Unknown, result.Failed)
+		return
+	}
+
+	if flag.Arg(0) == "reprocess-tx" {
+		var sink indexer.EventSink
+		if *storeTx && !cfg.DryRun {
+			sink = indexer.NewDBSink(db)
+		}
+		if err := indexer.ReprocessTx(context.Background(), cfg, sink, os.Stdout, flag.Arg(1)); err != nil {
+			fmt.Printf("Failed to reprocess transaction: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "gap-fill" {
+		var sink indexer.EventSink = indexer.NewDBSink(db)
+		if cfg.DryRun {
+			sink = indexer.DryRunSink{}
+		}
+		if err := indexer.FillScanGaps(context.Background(), cfg, db, sink, os.Stdout); err != nil {
+			fmt.Printf("Failed to fill scan gaps: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "export" {
+		out := os.Stdout
+		if *exportOut != "" {
+			out, err = os.Create(*exportOut)
+			if err != nil {
+				panic(fmt.Sprintf("Failed to create export file: %v", err))
+			}
+			defer out.Close()
+		}
+		count, err := indexer.ExportEvents(context.Background(), db, out, indexer.ExportOptions{
+			Table:     *exportTable,
+			FromBlock: *exportFrom,
+			ToBlock:   *exportTo,
+			MarketID:  *exportMarket,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export events: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d rows from %s\n", count, *exportTable)
+		return
+	}
+
 	if cfg.MigrateOnStart {
 		for _, table := range tables {
 			if err := db.AutoMigrate(table); err != nil {
@@ -60,25 +216,107 @@ if strings.Contains(err.Error(), "already exists (SQLSTATE 42701)") {
 				}
 			}
 		}
+		if err := config.PadBigIntColumns(db, tables...); err != nil {
+			panic(fmt.Sprintf("Failed to pad numeric columns: %v", err))
+		}
+		if err := config.EnsureMarketSearchIndex(db); err != nil {
+			panic(fmt.Sprintf("Failed to create market search index: %v", err))
+		}
+		if cfg.StoreBlockTime {
+			if err := config.BackfillBlockTimes(db); err != nil {
+				panic(fmt.Sprintf("Failed to backfill block times: %v", err))
+			}
+		}
 	}
 
-	if cfg.ForceResyncOnEveryStart {
+	if cfg.ForceResyncOnEveryStart && !cfg.DryRun {
 		fmt.Println("Force resync enabled, truncating all indexing tables...")
 		for _, table := range tables {
-			if err := db.Exec(fmt.Sprintf("TRUNCATE TABLE %s RESTART IDENTITY CASCADE;", config.GetTableName(db, table))).Error; err != nil {
+			if err := db.Exec(config.TruncateTableSQL(db, config.GetTableName(db, table))).Error; err != nil {
 				panic(fmt.Sprintf("Failed to truncate table: %v", err))
 			}
 		}
 		fmt.Println("All tables truncated successfully.")
 	}
 
+	if !cfg.DryRun {
+		if err := config.AssignDefaultNetwork(db, cfg.NetworkNames()[0]); err != nil {
+			panic(fmt.Sprintf("Failed to assign default network: %v", err))
+		}
+	}
+
+	if *startBlock != "" {
+		overrides, err := config.ParseStartBlockOverrides(*startBlock)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid -start-block: %v", err))
+		}
+		if err := config.ApplyStartBlockOverrides(db, overrides); err != nil {
+			panic(fmt.Sprintf("Failed to apply start block override: %v", err))
+		}
+	}
+
+	if cfg.DiscoverStartBlocks {
+		indexer.DiscoverStartBlocks(context.Background(), cfg, db)
+	}
+
 	config.EnsureInitialSyncStateData(db)
 
+	var feed *indexer.EventFeed
+	if cfg.APIAddr != "" {
+		feed = indexer.NewEventFeed()
+		go func() {
+			fmt.Printf("Serving API on %s\n", cfg.APIAddr)
+			if err := http.ListenAndServe(cfg.APIAddr, indexer.NewAPIHandler(db, feed)); err != nil {
+				log.Printf("API server stopped: %v", err)
+			}
+		}()
+	}
+
+	if cfg.PprofAddr != "" {
+		go func() {
+			fmt.Printf("Serving pprof on %s\n", cfg.PprofAddr)
+			if err := http.ListenAndServe(cfg.PprofAddr, nil); err != nil {
+				log.Printf("pprof server stopped: %v", err)
+			}
+		}()
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	sink := indexer.MultiSink{indexer.NewDBSink(db)}
+	if cfg.DryRun {
+		fmt.Println("Dry run enabled, events will be parsed but not stored")
+		sink = indexer.MultiSink{indexer.DryRunSink{}}
+	} else if len(cfg.KafkaBrokers) > 0 {
+		kafkaSink := indexer.NewKafkaSink(cfg.KafkaBrokers, cfg.KafkaTopic)
+		defer kafkaSink.Close()
+		sink = append(sink, kafkaSink)
+	}
+	if feed != nil && !cfg.DryRun {
+		sink = append(sink, feed)
+	}
+
+	if !cfg.DryRun {
+		if err := indexer.ReplayQueue(ctx, db, sink); err != nil {
+			fmt.Printf("Error replaying queue: %s\n", err)
+		}
+	}
+
+	if !cfg.SkipSelfTest {
+		if err := indexer.SelfTest(ctx, cfg, db); err != nil {
+			fmt.Printf("Startup self-test failed:\n%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Startup self-test passed")
+	}
+
 	fmt.Println("Start indexing...")
-	go indexer.RunIndexer(ctx, cfg)
+	done := make(chan struct{})
+	go func() {
+		indexer.RunIndexer(ctx, cfg, db, sink)
+		close(done)
+	}()
 
 	if cfg.Mode == config.ModeLiquidator {
 
@@ -86,8 +324,12 @@ if strings.Contains(err.Error(), "already exists (SQLSTATE 42701)") {
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	<-sigs
-	log.Println("Received termination signal, stopping application...")
+	select {
+	case <-sigs:
+		log.Println("Received termination signal, stopping application...")
+	case <-done:
+		log.Println("Indexer finished, stopping application...")
+	}
 
 	close(indexer.Shutdown)
 
@@ -100,4 +342,8 @@ if strings.Contains(err.Error(), "already exists (SQLSTATE 42701)") {
 	cancel()
 
 	time.Sleep(3 * time.Second)
+
+	if err := config.CloseDB(); err != nil {
+		fmt.Printf("Error closing database: %s\n", err)
+	}
 }